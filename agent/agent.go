@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -28,6 +29,10 @@ type ModelResponseMsg struct {
 	Response string
 }
 
+type ModelDeltaMsg struct {
+	Delta string
+}
+
 type TokenUsageMsg struct {
 	Usage float64
 }
@@ -41,13 +46,51 @@ type ErrorMsg struct {
 	Msg string
 }
 
-type Agent struct {
-	lock    sync.Mutex
-	model   contextwindow.Model
-	context *contextwindow.ContextWindow
-	db      *sql.DB
+type CancelledMsg struct{}
+
+type StreamingModel interface {
+	SetOnDelta(func(delta string))
+}
+
+type quietKey struct{}
+
+// model calls the agent makes on its own behalf, like summaries for
+// compaction, aren't an answer to the user, so they don't stream.
+func quietCall(ctx context.Context) context.Context {
+	return context.WithValue(ctx, quietKey{}, true)
+}
+
+func isQuiet(ctx context.Context) bool {
+	quiet, _ := ctx.Value(quietKey{}).(bool)
+	return quiet
+}
 
-	OnEvent func(Message)
+type Agent struct {
+	lock      sync.Mutex
+	model     *switchModel
+	context   *contextwindow.ContextWindow
+	db        *sql.DB
+	artifacts *ArtifactStore
+	todos     *TodoStore
+	notes     *NoteStore
+
+	cancelLock sync.Mutex
+	cancel     context.CancelFunc
+
+	pressure       PressurePolicy
+	pressureWarned bool
+
+	// settings is read from the UI while turns run, so it has its own
+	// lock rather than the turn's.
+	settingsLock sync.Mutex
+	settings     ContextSettings
+
+	// summaries go to the model unless this is set.
+	summarizer contextwindow.Model
+
+	OnEvent   func(Message)
+	Approve   Approver
+	OpenModel ModelOpener
 }
 
 func NewAgentForked(db *sql.DB, model contextwindow.Model, contextName, oldName string) (*Agent, error) {
@@ -60,7 +103,16 @@ func NewAgentForked(db *sql.DB, model contextwindow.Model, contextName, oldName
 		return nil, err
 	}
 
-	return NewAgent(db, model, contextName)
+	agent, err := NewAgent(db, model, contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := copyContextState(db, oldName, contextName); err != nil {
+		return nil, err
+	}
+
+	return agent, nil
 }
 
 func NewAgent(db *sql.DB, model contextwindow.Model, contextName string) (*Agent, error) {
@@ -68,25 +120,52 @@ func NewAgent(db *sql.DB, model contextwindow.Model, contextName string) (*Agent
 		contextName = uuid.New().String()
 	}
 
-	cw, err := contextwindow.NewContextWindowWithThreading(db, model, contextName, true)
+	if err := InitializeSchema(db); err != nil {
+		return nil, err
+	}
+
+	_, threading := model.(contextwindow.ServerSideThreadingCapable)
+
+	proxy := &switchModel{inner: model}
+
+	cw, err := contextwindow.NewContextWindowWithThreading(db, proxy, contextName, threading)
 	if err != nil {
 		return nil, fmt.Errorf("create context window: %w", err)
 	}
 
 	agent := &Agent{
-		model:   model,
-		context: cw,
-		db:      db,
+		model:     proxy,
+		context:   cw,
+		db:        db,
+		artifacts: NewArtifactStore(db),
+		todos:     NewTodoStore(db),
+		notes:     NewNoteStore(db),
 	}
 
 	cw.AddMiddleware(&agentMiddleware{
 		agent: agent,
 	})
 
+	proxy.SetOnDelta(agent.sendDelta)
+
 	return agent, nil
 }
 
 func (a *Agent) SendPrompt(prompt string) error {
+	a.startTurn(prompt)
+
+	go a.finishTurn()
+
+	return nil
+}
+
+func (a *Agent) RunPrompt(prompt string) (string, error) {
+	a.startTurn(prompt)
+
+	return a.finishTurn()
+}
+
+func (a *Agent) startTurn(prompt string) {
 	a.lock.Lock()
 	a.context.AddPrompt(prompt)
 	a.lock.Unlock()
@@ -96,56 +175,113 @@ func (a *Agent) SendPrompt(prompt string) error {
 	}
 
 	a.sendTokenUsage()
+}
 
-	go func() {
-		response, err := a.callModel()
-		if err != nil {
-			if a.OnEvent != nil {
-				a.OnEvent(ErrorMsg{
-					Err: err,
-					Msg: err.Error() + "\n",
-				})
-			}
-		} else {
-			if a.OnEvent != nil {
-				a.OnEvent(ModelResponseMsg{Response: response})
-			}
+func (a *Agent) finishTurn() (string, error) {
+	response, err := a.callModel()
+	if errors.Is(err, context.Canceled) {
+		a.recordCancellation()
+		if a.OnEvent != nil {
+			a.OnEvent(CancelledMsg{})
 		}
-
-		a.sendTokenUsage()
-
+	} else if err != nil {
 		if a.OnEvent != nil {
-			a.OnEvent(WorkingMsg{Working: false})
+			a.OnEvent(ErrorMsg{
+				Err: err,
+				Msg: err.Error() + "\n",
+			})
 		}
-	}()
+	} else {
+		a.recordModel()
+		if a.OnEvent != nil {
+			a.OnEvent(ModelResponseMsg{Response: response})
+		}
+	}
 
-	return nil
+	a.sendTokenUsage()
+
+	if a.OnEvent != nil {
+		a.OnEvent(WorkingMsg{Working: false})
+	}
+
+	return response, err
 }
 
 func (a *Agent) callModel() (string, error) {
 	a.lock.Lock()
 	defer a.lock.Unlock()
 
-	response, err := a.context.CallModel(context.TODO())
+	ctx, cancel := context.WithCancel(context.Background())
+	a.setCancel(cancel)
+	defer a.setCancel(nil)
+	defer cancel()
+
+	a.relievePressure(ctx)
+
+	since := a.lastRecordID()
+
+	response, err := a.context.CallModel(ctx)
+	a.recordResponseModels(since)
 	if err != nil {
 		slog.Info("llm call error", "error", err)
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("call model: %w", ctx.Err())
+		}
 		return "", err
 	}
 
 	return response, nil
 }
 
-func (a *Agent) SwitchContext(name string) error {
+func (a *Agent) setCancel(cancel context.CancelFunc) {
+	a.cancelLock.Lock()
+	defer a.cancelLock.Unlock()
+
+	a.cancel = cancel
+}
+
+func (a *Agent) Cancel() bool {
+	a.cancelLock.Lock()
+	defer a.cancelLock.Unlock()
+
+	if a.cancel == nil {
+		return false
+	}
+
+	a.cancel()
+	a.cancel = nil
+	return true
+}
+
+func (a *Agent) recordCancellation() {
 	a.lock.Lock()
 	defer a.lock.Unlock()
 
-	err := a.context.SwitchContext(name)
+	info, err := a.context.GetCurrentContextInfo()
+	if err != nil {
+		slog.Error("record cancellation", "error", err)
+		return
+	}
+
+	_, err = contextwindow.InsertRecord(a.db, info.ID,
+		contextwindow.ModelResp, "(turn cancelled by user)", true)
 	if err != nil {
+		slog.Error("record cancellation", "error", err)
+	}
+}
+
+// waits out any turn in progress, and holds the next one off until the
+// conversation's settings are back in effect.
+func (a *Agent) SwitchContext(name string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if err := a.context.SwitchContext(name); err != nil {
 		slog.Error("switch context", "error", err)
 		return fmt.Errorf("switch context: %w", err)
 	}
 
-	return nil
+	return a.restoreSettings()
 }
 
 func (a *Agent) ListContexts() (ret []string, err error) {
@@ -161,35 +297,116 @@ func (a *Agent) ListContexts() (ret []string, err error) {
 	return ret, nil
 }
 
+// tools loaded from other files stay registered but are hidden from
+// the model; loading a file again re-registers its tools.
 func (a *Agent) LoadTools(configPath string) error {
 	tools, err := LoadToolConfig(configPath)
 	if err != nil {
 		return fmt.Errorf("load tool config: %w", err)
 	}
 
-	if err := LoadTools(a.context, tools); err != nil {
+	hooks := ToolHooks{
+		Approve: a.approve,
+		Spill:   a.spill,
+	}
+
+	if err := LoadTools(a.context, tools, hooks); err != nil {
 		return fmt.Errorf("load tools: %w", err)
 	}
 
+	names := []string{}
+	for _, t := range tools.Tools {
+		names = append(names, t.Name)
+	}
+
+	a.model.tools.restrict(names)
+
+	a.settingsLock.Lock()
+	a.settings.ToolsPath = configPath
+	a.settingsLock.Unlock()
+
 	return nil
 }
 
+func (a *Agent) approve(ctx context.Context, tool string, argv []string) (bool, error) {
+	if a.Approve == nil {
+		return false, nil
+	}
+	return a.Approve(ctx, tool, argv)
+}
+
+func (a *Agent) spill(tool, output string) (string, error) {
+	id, err := a.artifacts.Put(a.ContextName(), tool, output)
+	if err != nil {
+		return "", err
+	}
+
+	return artifactPreview(id, output), nil
+}
+
+func (a *Agent) Artifacts() *ArtifactStore {
+	return a.artifacts
+}
+
+func (a *Agent) Todos() *TodoStore {
+	return a.todos
+}
+
+func (a *Agent) Notes() *NoteStore {
+	return a.notes
+}
+
 func (a *Agent) RegisterBuiltinTool(name string, tool BuiltinTool) {
 	LoadBuiltin(name, tool)
 }
 
+func (a *Agent) ContextName() string {
+	return a.context.GetCurrentContext()
+}
+
 func (a *Agent) GetContextWindow() *contextwindow.ContextWindow {
 	return a.context
 }
 
 func (a *Agent) SetSystemPrompt(prompt string) {
+	a.settingsLock.Lock()
+	a.settings.SystemPrompt = prompt
+	a.settingsLock.Unlock()
+
 	a.context.SetSystemPrompt(prompt)
 }
 
+func (a *Agent) SetModelName(name string) {
+	a.model.setName(name)
+}
+
+func (a *Agent) ModelName() string {
+	return a.model.Name()
+}
+
+// the endpoint the current model was opened at, to open it there
+// again when the conversation is resumed.
+func (a *Agent) SetBaseURL(url string) {
+	a.settingsLock.Lock()
+	defer a.settingsLock.Unlock()
+
+	a.settings.BaseURL = url
+}
+
 func (a *Agent) SetMaxTokens(max int) {
+	a.settingsLock.Lock()
+	a.settings.MaxTokens = max
+	a.settingsLock.Unlock()
+
 	a.context.SetMaxTokens(max)
 }
 
+func (a *Agent) sendDelta(delta string) {
+	if a.OnEvent != nil && delta != "" {
+		a.OnEvent(ModelDeltaMsg{Delta: delta})
+	}
+}
+
 func (a *Agent) sendTokenUsage() {
 	if a.OnEvent == nil {
 		return
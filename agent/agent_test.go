@@ -0,0 +1,352 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/superfly/contextwindow"
+)
+
+func recordEvents(ag *Agent) *[]Message {
+	var events []Message
+	ag.OnEvent = func(msg Message) {
+		events = append(events, msg)
+	}
+	return &events
+}
+
+func TestAgentToolLoop(t *testing.T) {
+	model, err := LoadFakeModel("testdata/investigate.yaml")
+	assert.NoError(t, err)
+
+	ag, err := NewAgent(testDB(t), model, "investigate")
+	assert.NoError(t, err)
+
+	tools := writeToolConfig(t, t.TempDir(), "tools.toml", `
+[[tool]]
+name = "ping"
+description = "ping a host"
+command = "echo pong {host}"
+
+[tool.parameters]
+host = { description = "host", required = true }
+`)
+	assert.NoError(t, ag.LoadTools(tools))
+
+	events := recordEvents(ag)
+
+	response, err := ag.RunPrompt("is pg-7 up?")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, model.Played())
+
+	var calls []ToolCallMsg
+	for _, e := range *events {
+		if tc, ok := e.(ToolCallMsg); ok {
+			calls = append(calls, tc)
+		}
+	}
+	assert.Len(t, calls, 2)
+	assert.Equal(t, `ping({"host":"pg-7"})`, calls[0].Msg)
+	assert.True(t, calls[1].Complete)
+	assert.NoError(t, calls[1].Err)
+
+	live, err := ag.GetContextWindow().LiveRecords()
+	assert.NoError(t, err)
+	assert.Len(t, live, 4)
+	assert.Equal(t, contextwindow.ToolOutput, live[2].Source)
+	assert.Equal(t, "pong pg-7\n", live[2].Content)
+	assert.Equal(t, response, live[3].Content)
+
+	followups := ParseFollowups(response)
+	assert.Equal(t, []Followup{
+		{Key: "F1", Description: "Check disk usage on pg-7"},
+		{Key: "F2", Description: "Look at the replication lag"},
+	}, followups)
+}
+
+func TestAgentLobotomize(t *testing.T) {
+	model, err := LoadFakeModel("testdata/lobotomize.yaml")
+	assert.NoError(t, err)
+
+	ag, err := NewAgent(testDB(t), model, "lobotomize")
+	assert.NoError(t, err)
+
+	ag.RegisterBuiltinTool("lobotomize", &Lobotomize{})
+	tools := writeToolConfig(t, t.TempDir(), "tools.toml", `
+[[tool]]
+name = "lobotomize"
+builtin = true
+`)
+	assert.NoError(t, ag.LoadTools(tools))
+
+	_, err = ag.RunPrompt("remember incident 42")
+	assert.NoError(t, err)
+
+	_, err = ag.RunPrompt("now forget it")
+	assert.NoError(t, err)
+
+	live, err := ag.GetContextWindow().LiveRecords()
+	assert.NoError(t, err)
+
+	var contents []string
+	for _, r := range live {
+		contents = append(contents, r.Content)
+	}
+	assert.Equal(t, []string{
+		"now forget it",
+		`lobotomize({"end":1,"start":0})`,
+		"Success.\n",
+		"forgotten.",
+	}, contents)
+
+	all, err := ag.Records()
+	assert.NoError(t, err)
+	assert.Len(t, all, 6)
+}
+
+func TestAgentTokenAccounting(t *testing.T) {
+	model := NewFakeModel([]FakeTurn{
+		{Response: "short", Tokens: 120},
+		{Response: "a much longer answer about replication lag", Tokens: 80},
+	})
+
+	ag, err := NewAgent(testDB(t), model, "tokens")
+	assert.NoError(t, err)
+	ag.SetMaxTokens(1000)
+
+	events := recordEvents(ag)
+
+	_, err = ag.RunPrompt("first")
+	assert.NoError(t, err)
+	_, err = ag.RunPrompt("second")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 200, ag.GetContextWindow().TotalTokens())
+
+	var usage []float64
+	for _, e := range *events {
+		if u, ok := e.(TokenUsageMsg); ok {
+			usage = append(usage, u.Usage)
+		}
+	}
+	assert.Len(t, usage, 4)
+	for i := 1; i < len(usage); i++ {
+		assert.Greater(t, usage[i], usage[i-1])
+	}
+
+	live, err := ag.GetContextWindow().LiveTokens()
+	assert.NoError(t, err)
+	assert.InDelta(t, float64(live)/1000, usage[3], 0.0001)
+}
+
+func TestAgentOffScript(t *testing.T) {
+	model := NewFakeModel([]FakeTurn{
+		{Expect: "pg-7", Response: "ok"},
+		{Error: "rate limited"},
+	})
+
+	ag, err := NewAgent(testDB(t), model, "offscript")
+	assert.NoError(t, err)
+
+	events := recordEvents(ag)
+
+	_, err = ag.RunPrompt("is pg-9 up?")
+	assert.ErrorContains(t, err, `expected prompt containing "pg-7"`)
+
+	var reported bool
+	for _, e := range *events {
+		if _, ok := e.(ErrorMsg); ok {
+			reported = true
+		}
+	}
+	assert.True(t, reported)
+
+	_, err = ag.RunPrompt("try again")
+	assert.ErrorContains(t, err, "rate limited")
+
+	_, err = ag.RunPrompt("and again")
+	assert.True(t, errors.Is(err, ErrScriptExhausted))
+
+	_, err = LoadFakeModel("testdata/missing.yaml")
+	assert.Error(t, err)
+}
+
+type streamingModel struct {
+	onDelta func(string)
+}
+
+func (m *streamingModel) SetOnDelta(f func(string)) {
+	m.onDelta = f
+}
+
+func (m *streamingModel) Call(ctx context.Context, inputs []contextwindow.Record) ([]contextwindow.Record, int, error) {
+	for _, d := range []string{"pg-7 ", "is ", "up"} {
+		m.onDelta(d)
+	}
+
+	return []contextwindow.Record{{
+		Source:  contextwindow.ModelResp,
+		Content: "pg-7 is up",
+		Live:    true,
+	}}, 10, nil
+}
+
+func TestAgentStreamsDeltas(t *testing.T) {
+	ag, err := NewAgent(testDB(t), &streamingModel{}, "stream")
+	assert.NoError(t, err)
+
+	events := recordEvents(ag)
+
+	response, err := ag.RunPrompt("is pg-7 up?")
+	assert.NoError(t, err)
+	assert.Equal(t, "pg-7 is up", response)
+
+	var (
+		deltas    []string
+		responded bool
+	)
+	for _, e := range *events {
+		switch e := e.(type) {
+		case ModelDeltaMsg:
+			assert.False(t, responded, "delta after the response")
+			deltas = append(deltas, e.Delta)
+		case ModelResponseMsg:
+			responded = true
+		}
+	}
+	assert.Equal(t, []string{"pg-7 ", "is ", "up"}, deltas)
+	assert.True(t, responded)
+}
+
+// what the TUI's confirm modal answers when the user says no.
+func TestAgentDeniedToolDoesNotRun(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "ran")
+
+	model := NewFakeModel([]FakeTurn{{
+		ToolCalls: []FakeToolCall{{Name: "mark", Args: map[string]any{"path": target}}},
+		Response:  "done",
+	}})
+
+	ag, err := NewAgent(testDB(t), model, "deny")
+	assert.NoError(t, err)
+
+	tools := writeToolConfig(t, t.TempDir(), "tools.toml", `
+[[tool]]
+name = "mark"
+description = "touch a file"
+command = "touch {path}"
+confirm = true
+
+[tool.parameters]
+path = { description = "path", required = true }
+`)
+	assert.NoError(t, ag.LoadTools(tools))
+
+	asked := 0
+	ag.Approve = func(ctx context.Context, tool string, argv []string) (bool, error) {
+		asked++
+		return false, nil
+	}
+
+	_, err = ag.RunPrompt("mark it")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, asked)
+	assert.NoFileExists(t, target)
+
+	live, err := ag.GetContextWindow().LiveRecords()
+	assert.NoError(t, err)
+	var outputs []string
+	for _, r := range live {
+		if r.Source == contextwindow.ToolOutput {
+			outputs = append(outputs, r.Content)
+		}
+	}
+	assert.Equal(t, []string{deniedResult([]string{"touch", target})}, outputs)
+}
+
+func TestAgentCancelDuringToolCall(t *testing.T) {
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "pid")
+
+	// exec, so the pid written is the sleep's.
+	script := filepath.Join(dir, "slow.sh")
+	assert.NoError(t, os.WriteFile(script,
+		[]byte("#!/bin/sh\necho $$ > "+pidFile+"\nexec sleep 30\n"), 0o755))
+
+	model := NewFakeModel([]FakeTurn{
+		{
+			ToolCalls: []FakeToolCall{{Name: "slow"}},
+			Response:  "never said",
+		},
+		{Response: "still here"},
+	})
+
+	ag, err := NewAgent(testDB(t), model, "cancel")
+	assert.NoError(t, err)
+	assert.NoError(t, ag.LoadTools(writeToolConfig(t, dir, "tools.toml", `
+[[tool]]
+name = "slow"
+description = "takes its time"
+command = "`+script+`"
+`)))
+
+	var (
+		lock      sync.Mutex
+		cancelled bool
+	)
+	ag.OnEvent = func(msg Message) {
+		switch msg := msg.(type) {
+		case ToolCallMsg:
+			if msg.Complete {
+				return
+			}
+			// cancel once the command is actually running.
+			go func() {
+				for {
+					if _, err := os.Stat(pidFile); err == nil {
+						ag.Cancel()
+						return
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+			}()
+		case CancelledMsg:
+			lock.Lock()
+			cancelled = true
+			lock.Unlock()
+		}
+	}
+
+	start := time.Now()
+	_, err = ag.RunPrompt("take your time")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	lock.Lock()
+	assert.True(t, cancelled)
+	lock.Unlock()
+
+	raw, err := os.ReadFile(pidFile)
+	assert.NoError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, syscall.Kill(pid, 0), syscall.ESRCH)
+
+	records, err := ag.Records()
+	assert.NoError(t, err)
+	assert.Equal(t, "(turn cancelled by user)", records[len(records)-1].Content)
+
+	ag.OnEvent = nil
+	response, err := ag.RunPrompt("are you there?")
+	assert.NoError(t, err)
+	assert.Equal(t, "still here", response)
+}
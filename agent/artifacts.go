@@ -0,0 +1,282 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superfly/contextwindow"
+)
+
+const (
+	artifactPreviewLines = 10
+	artifactPageLines    = 200
+	artifactMaxResponse  = 16 * 1024
+	artifactMaxMatches   = 100
+)
+
+type ArtifactRecord struct {
+	ID        string
+	Context   string
+	Tool      string
+	CreatedAt time.Time
+	Content   string
+}
+
+type ArtifactStore struct {
+	db *sql.DB
+}
+
+func NewArtifactStore(db *sql.DB) *ArtifactStore {
+	return &ArtifactStore{db: db}
+}
+
+func (s *ArtifactStore) Put(contextName, tool, content string) (string, error) {
+	id := "art-" + uuid.New().String()[:8]
+
+	_, err := s.db.Exec(
+		`INSERT INTO artifacts (id, context, tool, created_at, content)
+		 VALUES (?, ?, ?, ?, ?)`,
+		id, contextName, tool, time.Now().UTC(), content,
+	)
+	if err != nil {
+		return "", fmt.Errorf("store artifact: %w", err)
+	}
+
+	return id, nil
+}
+
+// only finds artifacts stored by contextName, so one conversation
+// can't read another's by guessing handles.
+func (s *ArtifactStore) Get(contextName, id string) (ArtifactRecord, error) {
+	var a ArtifactRecord
+
+	err := s.db.QueryRow(
+		`SELECT id, context, tool, created_at, content
+		 FROM artifacts WHERE id = ? AND context = ?`,
+		id, contextName,
+	).Scan(&a.ID, &a.Context, &a.Tool, &a.CreatedAt, &a.Content)
+	if err != nil {
+		return a, fmt.Errorf("get artifact %s: %w", id, err)
+	}
+
+	return a, nil
+}
+
+func (s *ArtifactStore) List(contextName string) ([]ArtifactRecord, error) {
+	rows, err := s.db.Query(
+		`SELECT id, context, tool, created_at, content
+		 FROM artifacts WHERE context = ? ORDER BY created_at ASC`,
+		contextName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list artifacts: %w", err)
+	}
+	defer rows.Close()
+
+	var ret []ArtifactRecord
+	for rows.Next() {
+		var a ArtifactRecord
+		if err := rows.Scan(&a.ID, &a.Context, &a.Tool, &a.CreatedAt, &a.Content); err != nil {
+			return nil, fmt.Errorf("scan artifact: %w", err)
+		}
+		ret = append(ret, a)
+	}
+
+	return ret, rows.Err()
+}
+
+func splitLines(s string) []string {
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func writeLines(buf *strings.Builder, lines []string, first int) {
+	for i, line := range lines {
+		fmt.Fprintf(buf, "%d: %s\n", first+i, line)
+	}
+}
+
+func artifactPreview(id, content string) string {
+	lines := splitLines(content)
+	buf := &strings.Builder{}
+
+	fmt.Fprintf(buf, "<artifact handle=\"%s\" bytes=\"%d\" lines=\"%d\">\n",
+		id, len(content), len(lines))
+
+	if len(lines) <= 2*artifactPreviewLines {
+		writeLines(buf, lines, 1)
+	} else {
+		writeLines(buf, lines[:artifactPreviewLines], 1)
+		fmt.Fprintf(buf, "... (%d lines omitted) ...\n",
+			len(lines)-2*artifactPreviewLines)
+		tail := len(lines) - artifactPreviewLines
+		writeLines(buf, lines[tail:], tail+1)
+	}
+
+	fmt.Fprintf(buf, "</artifact>\n")
+	fmt.Fprintf(buf, "The full output was too large for the context window. "+
+		"Use the \"artifact\" tool with handle %s to page, grep, or slice it.\n", id)
+
+	return truncate(buf.String(), artifactMaxResponse)
+}
+
+type Artifact struct {
+	store *ArtifactStore
+	cw    *contextwindow.ContextWindow
+}
+
+func NewArtifact(store *ArtifactStore) *Artifact {
+	return &Artifact{store: store}
+}
+
+func (a *Artifact) ToolDescription() string {
+	return `
+name = "artifact"
+description = """
+Read large tool outputs that were stored out-of-band instead of being
+placed in the conversation. Those outputs are replaced by an
+<artifact handle="..."> preview; pass that handle here.
+
+You MUST call this tool with an "action".
+
+"list" lists the stored artifacts for this conversation.
+"page" returns one numbered page of lines (200 lines per page, starting at 1).
+"slice" returns lines "start" through "end", inclusive, numbered from 1.
+"grep" returns the numbered lines matching the regular expression "pattern".
+"""
+
+[parameters]
+action = { type = "string", description = "list, page, slice, or grep", required = true }
+handle = { type = "string", description = "The artifact handle, like art-1a2b3c4d", required = false }
+page = { type = "number", description = "Page number for page, starting at 1", required = false }
+start = { type = "number", description = "First line for slice", required = false }
+end = { type = "number", description = "Last line for slice", required = false }
+pattern = { type = "string", description = "Regular expression for grep", required = false }
+`
+}
+
+func (a *Artifact) Init(cw *contextwindow.ContextWindow) error {
+	a.cw = cw
+	return nil
+}
+
+func (a *Artifact) Run(ctx context.Context, rawargs json.RawMessage) (string, error) {
+	args := map[string]any{}
+	if err := json.Unmarshal(rawargs, &args); err != nil {
+		return "", err
+	}
+
+	action, ok := mapGet[string](args, "action")
+	if !ok {
+		return "", fmt.Errorf("no valid action")
+	}
+
+	if action == "list" {
+		return a.list()
+	}
+
+	handle, ok := mapGet[string](args, "handle")
+	if !ok {
+		return "", fmt.Errorf("must provide 'handle' parameter")
+	}
+
+	art, err := a.store.Get(a.cw.GetCurrentContext(), handle)
+	if err != nil {
+		return "", fmt.Errorf("no artifact %s", handle)
+	}
+
+	lines := splitLines(art.Content)
+	buf := &strings.Builder{}
+
+	switch action {
+	case "page":
+		page, ok := mapGet[float64](args, "page")
+		if !ok || page < 1 {
+			page = 1
+		}
+
+		start := (int(page) - 1) * artifactPageLines
+		if start >= len(lines) {
+			return "", fmt.Errorf("page %d out of range (have %d lines)", int(page), len(lines))
+		}
+		end := min(start+artifactPageLines, len(lines))
+
+		fmt.Fprintf(buf, "page %d of %d\n", int(page),
+			(len(lines)+artifactPageLines-1)/artifactPageLines)
+		writeLines(buf, lines[start:end], start+1)
+
+	case "slice":
+		start, ok := mapGet[float64](args, "start")
+		if !ok {
+			return "", fmt.Errorf("must provide 'start' parameter")
+		}
+
+		end, ok := mapGet[float64](args, "end")
+		if !ok {
+			end = start + artifactPageLines - 1
+		}
+
+		s, e := max(int(start), 1), min(int(end), len(lines))
+		if s > e {
+			return "", fmt.Errorf("invalid range %d-%d (have %d lines)", int(start), int(end), len(lines))
+		}
+
+		writeLines(buf, lines[s-1:e], s)
+
+	case "grep":
+		pattern, ok := mapGet[string](args, "pattern")
+		if !ok {
+			return "", fmt.Errorf("must provide 'pattern' parameter")
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", fmt.Errorf("bad pattern: %w", err)
+		}
+
+		matches := 0
+		for i, line := range lines {
+			if !re.MatchString(line) {
+				continue
+			}
+
+			if matches++; matches > artifactMaxMatches {
+				fmt.Fprintf(buf, "(more matches omitted; narrow the pattern)\n")
+				break
+			}
+			fmt.Fprintf(buf, "%d: %s\n", i+1, line)
+		}
+
+		if matches == 0 {
+			fmt.Fprintf(buf, "no matches\n")
+		}
+
+	default:
+		return "", fmt.Errorf("invalid action %s", action)
+	}
+
+	return truncate(buf.String(), artifactMaxResponse), nil
+}
+
+func (a *Artifact) list() (string, error) {
+	arts, err := a.store.List(a.cw.GetCurrentContext())
+	if err != nil {
+		return "", err
+	}
+
+	buf := &strings.Builder{}
+
+	fmt.Fprintf(buf, "<artifacts>\n")
+	for _, art := range arts {
+		fmt.Fprintf(buf, "%s %s (%d bytes, %d lines)\n",
+			art.ID, art.Tool, len(art.Content), len(splitLines(art.Content)))
+	}
+	fmt.Fprintf(buf, "</artifacts>\n")
+
+	return buf.String(), nil
+}
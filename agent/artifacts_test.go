@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/superfly/contextwindow"
+)
+
+func testDB(t *testing.T) *sql.DB {
+	db, err := contextwindow.NewContextDB(":memory:")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	assert.NoError(t, InitializeSchema(db))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func runArtifact(t *testing.T, a *Artifact, args map[string]any) string {
+	raw, err := json.Marshal(args)
+	assert.NoError(t, err)
+	out, err := a.Run(context.Background(), raw)
+	assert.NoError(t, err)
+	return out
+}
+
+func TestArtifactSpillAndRead(t *testing.T) {
+	ag, err := NewAgent(testDB(t), NewFakeModel(nil), "ctx")
+	assert.NoError(t, err)
+	store := ag.Artifacts()
+
+	buf := &strings.Builder{}
+	for i := 1; i <= 500; i++ {
+		fmt.Fprintf(buf, "line %d\n", i)
+	}
+
+	id, err := store.Put("ctx", "logs", buf.String())
+	assert.NoError(t, err)
+
+	preview := artifactPreview(id, buf.String())
+	assert.Contains(t, preview, `lines="500"`)
+	assert.Contains(t, preview, "1: line 1\n")
+	assert.Contains(t, preview, "500: line 500\n")
+	assert.NotContains(t, preview, "line 250\n")
+
+	a := NewArtifact(store)
+	assert.NoError(t, a.Init(ag.GetContextWindow()))
+
+	out := runArtifact(t, a, map[string]any{
+		"action": "page",
+		"handle": id,
+		"page":   2,
+	})
+	assert.Contains(t, out, "page 2 of 3")
+	assert.Contains(t, out, "201: line 201\n")
+	assert.NotContains(t, out, "401: line 401\n")
+
+	out = runArtifact(t, a, map[string]any{
+		"action": "slice",
+		"handle": id,
+		"start":  10,
+		"end":    11,
+	})
+	assert.Equal(t, "10: line 10\n11: line 11\n", out)
+
+	out = runArtifact(t, a, map[string]any{
+		"action":  "grep",
+		"handle":  id,
+		"pattern": "^line 49[89]$",
+	})
+	assert.Equal(t, "498: line 498\n499: line 499\n", out)
+}
+
+func TestArtifactScopedToContext(t *testing.T) {
+	ag, err := NewAgent(testDB(t), NewFakeModel(nil), "mine")
+	assert.NoError(t, err)
+
+	theirs, err := ag.Artifacts().Put("theirs", "logs", "secret\n")
+	assert.NoError(t, err)
+
+	_, err = ag.Artifacts().Get("theirs", theirs)
+	assert.NoError(t, err)
+	_, err = ag.Artifacts().Get("mine", theirs)
+	assert.Error(t, err)
+
+	a := NewArtifact(ag.Artifacts())
+	assert.NoError(t, a.Init(ag.GetContextWindow()))
+
+	raw, err := json.Marshal(map[string]any{"action": "page", "handle": theirs})
+	assert.NoError(t, err)
+	_, err = a.Run(context.Background(), raw)
+	assert.ErrorContains(t, err, "no artifact")
+}
+
+func TestArtifactFollowsFork(t *testing.T) {
+	db := testDB(t)
+
+	ag, err := NewAgent(db, NewFakeModel(nil), "a")
+	assert.NoError(t, err)
+
+	handle, err := ag.Artifacts().Put("a", "logs", "disk full\n")
+	assert.NoError(t, err)
+
+	read := func(ag *Agent) (string, error) {
+		a := NewArtifact(ag.Artifacts())
+		assert.NoError(t, a.Init(ag.GetContextWindow()))
+
+		raw, err := json.Marshal(map[string]any{"action": "page", "handle": handle})
+		assert.NoError(t, err)
+		return a.Run(context.Background(), raw)
+	}
+
+	assert.NoError(t, ag.ForkContext("a", "b"))
+	assert.NoError(t, ag.SwitchContext("b"))
+	out, err := read(ag)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "disk full")
+
+	forked, err := NewAgentForked(db, NewFakeModel(nil), "c", "a")
+	assert.NoError(t, err)
+	out, err = read(forked)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "disk full")
+
+	// each fork has its own copy.
+	assert.NoError(t, ag.DeleteContext("a"))
+	_, err = ag.Artifacts().Get("c", handle)
+	assert.NoError(t, err)
+}
+
+func TestArtifactsFromBeforeRekey(t *testing.T) {
+	db, err := contextwindow.NewContextDB(":memory:")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	_, err = db.Exec(`
+CREATE TABLE artifacts (
+    id         TEXT PRIMARY KEY,
+    context    TEXT NOT NULL,
+    tool       TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    content    TEXT NOT NULL
+);
+INSERT INTO artifacts VALUES ('art-1', 'a', 'logs', '2026-01-01', 'disk full');
+`)
+	assert.NoError(t, err)
+
+	assert.NoError(t, InitializeSchema(db))
+	assert.NoError(t, InitializeSchema(db))
+
+	store := NewArtifactStore(db)
+	a, err := store.Get("a", "art-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "disk full", a.Content)
+
+	assert.NoError(t, copyContextState(db, "a", "b"))
+	_, err = store.Get("b", "art-1")
+	assert.NoError(t, err)
+}
@@ -1,13 +1,11 @@
 package agent
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"log/slog"
 	"strings"
-	"sync"
+	"unicode/utf8"
 
 	"github.com/superfly/contextwindow"
 )
@@ -18,96 +16,6 @@ type BuiltinTool interface {
 	Run(context.Context, json.RawMessage) (string, error)
 }
 
-type Todo struct {
-	lock  sync.Mutex
-	todos []string
-}
-
-func (t *Todo) ToolDescription() string {
-	return `
-name = "todo"
-description = """
-Manage a list of todo steps; good for multistep processes, internal planning, scratch memory.
-
-You MUST call this tool with an "action".
-
-tool({"action":"add", "entry":"a cool new todo list entry")
-
-"add" adds elements to the list.
-"list" gives a numbered list of the current todo elements.
-"delete" deletes a numbered entry from the list.
-"""
-
-[parameters]
-action = { type = "string", description = "add or delete or list", required = true }
-entry = { type = "string", description = "A blob of text to add to the todo list", required = false }
-number = { type = "number", description = "The number of an entry to delete", required = false }
-`
-}
-
-func (t *Todo) Init(cw *contextwindow.ContextWindow) error {
-	return nil
-}
-
-func (t *Todo) Run(ctx context.Context, rawargs json.RawMessage) (string, error) {
-	slog.Info("todo run", "args", string(rawargs))
-
-	t.lock.Lock()
-	defer t.lock.Unlock()
-
-	out := &bytes.Buffer{}
-
-	args := map[string]any{}
-	if err := json.Unmarshal(rawargs, &args); err != nil {
-		return "", err
-	}
-
-	action, ok := mapGet[string](args, "action")
-	if !ok {
-		return "", fmt.Errorf("no valid action")
-	}
-
-	switch action {
-	case "add":
-		entry, ok := mapGet[string](args, "entry")
-		if !ok {
-			return "", fmt.Errorf("no entry")
-		}
-		t.todos = append(t.todos, entry)
-
-	case "list":
-		fmt.Fprintf(out, "<todo_entries>\n")
-
-		for i, e := range t.todos {
-			fmt.Fprintf(out, "%d. %s\n", i+1, e)
-		}
-
-		fmt.Fprintf(out, "</todo_entries>\n")
-
-	case "delete":
-		num, ok := mapGet[int](args, "number")
-		if !ok {
-			return "", fmt.Errorf("no number")
-		}
-
-		todo := t.todos
-		newdos := []string{}
-		for i, e := range todo {
-			if i+1 != num {
-				newdos = append(newdos, e)
-			} else {
-				fmt.Fprintf(out, "deleted %d\n", num)
-			}
-		}
-		t.todos = newdos
-
-	default:
-		return "", fmt.Errorf("invalid action %s", action)
-	}
-
-	return out.String(), nil
-}
-
 type Review struct {
 	cw *contextwindow.ContextWindow
 }
@@ -138,25 +46,18 @@ func (r *Review) Run(ctx context.Context, rawargs json.RawMessage) (string, erro
 		return "", err
 	}
 
-	trunc := func(s string, n int) string {
-		if len(s) <= n {
-			return s
-		}
-		return fmt.Sprintf("%s... + %d bytes", s[:n], len(s)-n)
-	}
-
 	buf := &strings.Builder{}
 
 	for i, record := range records {
 		switch record.Source {
 		case contextwindow.Prompt:
-			fmt.Fprintf(buf, "%d (user) %s...\n", i, trunc(record.Content, 40))
+			fmt.Fprintf(buf, "%d (user) %s...\n", i, truncate(record.Content, 40))
 		case contextwindow.ModelResp:
-			fmt.Fprintf(buf, "%d (model) %s...\n", i, trunc(record.Content, 40))
+			fmt.Fprintf(buf, "%d (model) %s...\n", i, truncate(record.Content, 40))
 		case contextwindow.ToolCall:
-			fmt.Fprintf(buf, "%d (toolcall) %s...\n", i, trunc(record.Content, 40))
+			fmt.Fprintf(buf, "%d (toolcall) %s...\n", i, truncate(record.Content, 40))
 		case contextwindow.ToolOutput:
-			fmt.Fprintf(buf, "%d (tool) %s...\n", i, trunc(record.Content, 40))
+			fmt.Fprintf(buf, "%d (tool) %s...\n", i, truncate(record.Content, 40))
 		}
 	}
 
@@ -217,3 +118,15 @@ func mapGet[T any](m map[string]any, key string) (T, bool) {
 	x, ok := v.(T)
 	return x, ok
 }
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return fmt.Sprintf("%s... + %d bytes", s[:n], len(s)-n)
+}
@@ -0,0 +1,412 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/superfly/contextwindow"
+)
+
+// ChatModel talks to anything that serves the OpenAI chat completions
+// API (llama.cpp, Ollama, vLLM, a mock) at baseURL, with plain HTTP.
+// it streams when something is listening for deltas, except for the
+// agent's own calls (summaries).
+type ChatModel struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+
+	executor   contextwindow.ToolExecutor
+	middleware []contextwindow.Middleware
+	onDelta    func(string)
+}
+
+func NewChatModel(baseURL, apiKey, model string) (*ChatModel, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("chat model: no base URL")
+	}
+	if model == "" {
+		return nil, fmt.Errorf("chat model: no model name")
+	}
+
+	return &ChatModel{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  http.DefaultClient,
+	}, nil
+}
+
+func (c *ChatModel) SetToolExecutor(e contextwindow.ToolExecutor) {
+	c.executor = e
+}
+
+func (c *ChatModel) SetMiddleware(mw []contextwindow.Middleware) {
+	c.middleware = mw
+}
+
+func (c *ChatModel) SetOnDelta(fn func(string)) {
+	c.onDelta = fn
+}
+
+type chatMessage struct {
+	Role       string         `json:"role"`
+	Content    string         `json:"content"`
+	ToolCalls  []chatToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+type chatToolCall struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type chatTool struct {
+	Type     string `json:"type"`
+	Function any    `json:"function"`
+}
+
+type chatRequest struct {
+	Model         string             `json:"model"`
+	Messages      []chatMessage      `json:"messages"`
+	Tools         []chatTool         `json:"tools,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+	StreamOptions *chatStreamOptions `json:"stream_options,omitempty"`
+}
+
+// without include_usage, most servers don't report usage when they
+// stream.
+type chatStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type chatUsage struct {
+	TotalTokens int `json:"total_tokens"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+		Delta   chatMessage `json:"delta"`
+	} `json:"choices"`
+	Usage *chatUsage `json:"usage"`
+}
+
+func (c *ChatModel) Call(ctx context.Context, inputs []contextwindow.Record) ([]contextwindow.Record, int, error) {
+	return c.CallWithOpts(ctx, inputs, contextwindow.CallModelOpts{})
+}
+
+func (c *ChatModel) CallWithOpts(ctx context.Context, inputs []contextwindow.Record, opts contextwindow.CallModelOpts) ([]contextwindow.Record, int, error) {
+	req := chatRequest{
+		Model:    c.model,
+		Messages: chatMessages(inputs),
+		Stream:   c.onDelta != nil && !isQuiet(ctx),
+	}
+	if req.Stream {
+		req.StreamOptions = &chatStreamOptions{IncludeUsage: true}
+	}
+
+	if c.executor != nil && !opts.DisableTools {
+		for _, t := range c.executor.GetRegisteredTools() {
+			req.Tools = append(req.Tools, chatTool{Type: "function", Function: t.Definition})
+		}
+	}
+
+	var (
+		events []contextwindow.Record
+		tokens int
+	)
+
+	for {
+		msg, used, err := c.complete(ctx, req)
+		if err != nil {
+			return nil, 0, err
+		}
+		tokens += used
+
+		if len(msg.ToolCalls) == 0 {
+			events = append(events, contextwindow.Record{
+				Source:  contextwindow.ModelResp,
+				Content: msg.Content,
+				Live:    true,
+			})
+			return events, tokens, nil
+		}
+
+		req.Messages = append(req.Messages, msg)
+
+		for _, tc := range msg.ToolCalls {
+			out := c.runTool(ctx, tc)
+
+			req.Messages = append(req.Messages, chatMessage{
+				Role:       "tool",
+				Content:    out,
+				ToolCallID: tc.ID,
+			})
+
+			call := fmt.Sprintf("%s(%s)", tc.Function.Name, tc.Function.Arguments)
+			events = append(events,
+				contextwindow.Record{
+					Source:  contextwindow.ToolCall,
+					Content: call,
+					Live:    true,
+				},
+				contextwindow.Record{
+					Source:  contextwindow.ToolOutput,
+					Content: out,
+					Live:    true,
+				})
+		}
+	}
+}
+
+func (c *ChatModel) runTool(ctx context.Context, tc chatToolCall) string {
+	return runTool(ctx, c.executor, c.middleware,
+		tc.Function.Name, tc.Function.Arguments)
+}
+
+// what a model does with a tool call it gets back: tell the
+// middleware, run it, and hand the output (or the error) back as text.
+func runTool(ctx context.Context, executor contextwindow.ToolExecutor, middleware []contextwindow.Middleware, name, args string) string {
+	for _, m := range middleware {
+		m.OnToolCall(ctx, name, args)
+	}
+
+	var (
+		out string
+		err = fmt.Errorf("no tools available")
+	)
+	if executor != nil {
+		out, err = executor.ExecuteTool(ctx, name, json.RawMessage(args))
+	}
+	if err != nil {
+		out = fmt.Sprintf("error: %s", err)
+	}
+
+	for _, m := range middleware {
+		m.OnToolResult(ctx, name, out, err)
+	}
+
+	return out
+}
+
+// earlier tool calls only survive as text in the context window, so
+// they go back as text, the way contextwindow's own OpenAI model does.
+func chatMessages(inputs []contextwindow.Record) []chatMessage {
+	var msgs []chatMessage
+
+	for _, r := range inputs {
+		switch r.Source {
+		case contextwindow.SystemPrompt:
+			msgs = append([]chatMessage{{Role: "system", Content: r.Content}}, msgs...)
+		case contextwindow.Prompt, contextwindow.ToolOutput:
+			msgs = append(msgs, chatMessage{Role: "user", Content: r.Content})
+		case contextwindow.ModelResp, contextwindow.ToolCall:
+			msgs = append(msgs, chatMessage{Role: "assistant", Content: r.Content})
+		}
+	}
+
+	return msgs
+}
+
+func (c *ChatModel) complete(ctx context.Context, req chatRequest) (chatMessage, int, error) {
+	headers := map[string]string{}
+	if c.apiKey != "" {
+		headers["Authorization"] = "Bearer " + c.apiKey
+	}
+
+	resp, err := postJSON(ctx, c.client, c.baseURL+"/chat/completions", headers, req)
+	if err != nil {
+		return chatMessage{}, 0, fmt.Errorf("chat: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if isEventStream(resp) {
+		onDelta := c.onDelta
+		if !req.Stream {
+			onDelta = nil
+		}
+		return readChatStream(resp.Body, onDelta)
+	}
+
+	var cr chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
+		return chatMessage{}, 0, fmt.Errorf("chat: decode response: %w", err)
+	}
+	if len(cr.Choices) == 0 {
+		return chatMessage{}, 0, fmt.Errorf("chat: no choices in response")
+	}
+
+	tokens := 0
+	if cr.Usage != nil {
+		tokens = cr.Usage.TotalTokens
+	}
+
+	return cr.Choices[0].Message, tokens, nil
+}
+
+// tool calls arrive in pieces keyed by index; the id and name come
+// with the first piece and the arguments accumulate.
+func readChatStream(r io.Reader, onDelta func(string)) (chatMessage, int, error) {
+	var (
+		msg     = chatMessage{Role: "assistant"}
+		content strings.Builder
+		tokens  int
+	)
+
+	err := scanEvents(r, func(data string) error {
+		if data == "[DONE]" {
+			return errStreamDone
+		}
+
+		var chunk chatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("decode stream: %w", err)
+		}
+		if chunk.Usage != nil {
+			tokens = chunk.Usage.TotalTokens
+		}
+		if len(chunk.Choices) == 0 {
+			return nil
+		}
+
+		delta := chunk.Choices[0].Delta
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			if onDelta != nil {
+				onDelta(delta.Content)
+			}
+		}
+
+		for _, tc := range delta.ToolCalls {
+			for len(msg.ToolCalls) <= tc.Index {
+				msg.ToolCalls = append(msg.ToolCalls, chatToolCall{Type: "function"})
+			}
+
+			call := &msg.ToolCalls[tc.Index]
+			if tc.ID != "" {
+				call.ID = tc.ID
+			}
+			if tc.Function.Name != "" {
+				call.Function.Name = tc.Function.Name
+			}
+			call.Function.Arguments += tc.Function.Arguments
+		}
+
+		return nil
+	})
+	if err != nil {
+		return chatMessage{}, 0, fmt.Errorf("chat: %w", err)
+	}
+
+	msg.Content = content.String()
+	return msg, tokens, nil
+}
+
+// posts body as JSON; anything but a 200 is an error, with what the
+// server had to say about it.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body any) (*http.Response, error) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return resp, nil
+}
+
+func isEventStream(resp *http.Response) bool {
+	return strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+}
+
+// fn returns it to stop reading early.
+var errStreamDone = errors.New("stream done")
+
+// hands fn the data of each server-sent event.
+func scanEvents(r io.Reader, fn func(data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+
+		err := fn(strings.TrimSpace(data))
+		if errors.Is(err, errStreamDone) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+
+	return nil
+}
+
+// contextwindow hands tool definitions over in OpenAI's function shape;
+// the other APIs want the same three things arranged differently.
+type toolSpec struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+func toolSpecs(executor contextwindow.ToolExecutor) ([]toolSpec, error) {
+	if executor == nil {
+		return nil, nil
+	}
+
+	var specs []toolSpec
+	for _, t := range executor.GetRegisteredTools() {
+		buf, err := json.Marshal(t.Definition)
+		if err != nil {
+			return nil, fmt.Errorf("tool %s: %w", t.Name, err)
+		}
+
+		var spec toolSpec
+		if err := json.Unmarshal(buf, &spec); err != nil {
+			return nil, fmt.Errorf("tool %s: %w", t.Name, err)
+		}
+		specs = append(specs, spec)
+	}
+
+	return specs, nil
+}
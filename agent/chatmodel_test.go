@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/superfly/contextwindow"
+)
+
+type echoTools struct {
+	calls []string
+}
+
+func (e *echoTools) ExecuteTool(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	e.calls = append(e.calls, name+" "+string(args))
+	return "pong from " + name, nil
+}
+
+func (e *echoTools) GetRegisteredTools() []contextwindow.ToolDefinition {
+	return []contextwindow.ToolDefinition{{
+		Name:       "ping",
+		Definition: contextwindow.NewTool("ping", "Ping a host").ToOpenAI(),
+	}}
+}
+
+func TestChatModelToolLoop(t *testing.T) {
+	var requests []chatRequest
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer sk-local", r.Header.Get("Authorization"))
+
+		var req chatRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(requests) == 1 {
+			fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"",
+				"tool_calls":[{"id":"call_1","type":"function",
+				"function":{"name":"ping","arguments":"{\"host\":\"pg-7\"}"}}]}}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"pg-7 is up"}}],
+			"usage":{"total_tokens":42}}`)
+	}))
+	defer srv.Close()
+
+	model, err := NewChatModel(srv.URL+"/v1/", "sk-local", "llama3")
+	assert.NoError(t, err)
+
+	tools := &echoTools{}
+	model.SetToolExecutor(tools)
+
+	events, tokens, err := model.Call(context.Background(), []contextwindow.Record{
+		{Source: contextwindow.SystemPrompt, Content: "be brief"},
+		{Source: contextwindow.Prompt, Content: "is pg-7 up?"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 42, tokens)
+
+	assert.Equal(t, []string{`ping {"host":"pg-7"}`}, tools.calls)
+	assert.Len(t, events, 3)
+	assert.Equal(t, contextwindow.ToolCall, events[0].Source)
+	assert.Equal(t, "pong from ping", events[1].Content)
+	assert.Equal(t, "pg-7 is up", events[2].Content)
+
+	assert.Len(t, requests, 2)
+	assert.Equal(t, "llama3", requests[0].Model)
+	assert.Equal(t, "system", requests[0].Messages[0].Role)
+	assert.Len(t, requests[0].Tools, 1)
+
+	last := requests[1].Messages[len(requests[1].Messages)-1]
+	assert.Equal(t, "tool", last.Role)
+	assert.Equal(t, "call_1", last.ToolCallID)
+}
+
+func TestChatModelStreaming(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.True(t, req.Stream)
+		assert.Equal(t, &chatStreamOptions{IncludeUsage: true}, req.StreamOptions)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, piece := range []string{"disk ", "is ", "full"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", piece)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"total_tokens\":42}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	model, err := NewChatModel(srv.URL, "", "qwen")
+	assert.NoError(t, err)
+
+	ag, err := NewAgent(testDB(t), model, "local")
+	assert.NoError(t, err)
+
+	var deltas []string
+	ag.OnEvent = func(msg Message) {
+		if d, ok := msg.(ModelDeltaMsg); ok {
+			deltas = append(deltas, d.Delta)
+		}
+	}
+
+	response, err := ag.RunPrompt("why is pg-7 slow?")
+	assert.NoError(t, err)
+	assert.Equal(t, "disk is full", response)
+	assert.Equal(t, "disk is full", strings.Join(deltas, ""))
+
+	usage, err := ag.GetContextWindow().TokenUsage()
+	assert.NoError(t, err)
+	assert.Equal(t, 42, usage.Total)
+}
+
+func TestChatModelSummaryDoesNotStream(t *testing.T) {
+	var streamed []bool
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		streamed = append(streamed, req.Stream)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"pg-7 disk full"}}]}`)
+	}))
+	defer srv.Close()
+
+	model, err := NewChatModel(srv.URL, "", "qwen")
+	assert.NoError(t, err)
+
+	db := testDB(t)
+	ag, err := NewAgent(db, model, "local")
+	assert.NoError(t, err)
+
+	var deltas int
+	ag.OnEvent = func(msg Message) {
+		if _, ok := msg.(ModelDeltaMsg); ok {
+			deltas++
+		}
+	}
+
+	info, err := ag.GetContextWindow().GetCurrentContextInfo()
+	assert.NoError(t, err)
+	for _, content := range []string{"check pg-7", "it's slow"} {
+		_, err := contextwindow.InsertRecord(db, info.ID, contextwindow.Prompt, content, true)
+		assert.NoError(t, err)
+	}
+
+	_, err = ag.Compact(context.Background(), 0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false}, streamed)
+	assert.Zero(t, deltas)
+}
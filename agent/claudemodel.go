@@ -0,0 +1,373 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/superfly/contextwindow"
+)
+
+const (
+	ClaudeHaiku45  = "claude-haiku-4-5"
+	ClaudeSonnet45 = "claude-sonnet-4-5"
+
+	defaultClaudeURL = "https://api.anthropic.com"
+	claudeVersion    = "2023-06-01"
+	claudeMaxTokens  = 8192
+)
+
+// ClaudeModel talks to Anthropic's Messages API with plain HTTP, the
+// same way ResponsesModel talks to OpenAI: the whole conversation goes
+// up every call, and everything but the agent's own calls streams.
+type ClaudeModel struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+
+	executor   contextwindow.ToolExecutor
+	middleware []contextwindow.Middleware
+	onDelta    func(string)
+}
+
+// an empty baseURL is Anthropic's.
+func NewClaudeModel(baseURL, apiKey, model string) (*ClaudeModel, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("ANTHROPIC_API_KEY not set")
+	}
+	if model == "" {
+		return nil, fmt.Errorf("claude model: no model name")
+	}
+	if baseURL == "" {
+		baseURL = defaultClaudeURL
+	}
+
+	return &ClaudeModel{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  http.DefaultClient,
+	}, nil
+}
+
+func (c *ClaudeModel) SetToolExecutor(e contextwindow.ToolExecutor) {
+	c.executor = e
+}
+
+func (c *ClaudeModel) SetMiddleware(mw []contextwindow.Middleware) {
+	c.middleware = mw
+}
+
+func (c *ClaudeModel) SetOnDelta(fn func(string)) {
+	c.onDelta = fn
+}
+
+type claudeBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   *string         `json:"content,omitempty"`
+}
+
+type claudeMessage struct {
+	Role    string        `json:"role"`
+	Content []claudeBlock `json:"content"`
+}
+
+type claudeTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type claudeRequest struct {
+	Model     string          `json:"model"`
+	MaxTokens int             `json:"max_tokens"`
+	System    string          `json:"system,omitempty"`
+	Messages  []claudeMessage `json:"messages"`
+	Tools     []claudeTool    `json:"tools,omitempty"`
+	Stream    bool            `json:"stream,omitempty"`
+}
+
+type claudeUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type claudeResponse struct {
+	Content []claudeBlock `json:"content"`
+	Usage   claudeUsage   `json:"usage"`
+}
+
+func (resp *claudeResponse) text() string {
+	var b strings.Builder
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			b.WriteString(block.Text)
+		}
+	}
+	return b.String()
+}
+
+func (c *ClaudeModel) Call(ctx context.Context, inputs []contextwindow.Record) ([]contextwindow.Record, int, error) {
+	return c.CallWithOpts(ctx, inputs, contextwindow.CallModelOpts{})
+}
+
+func (c *ClaudeModel) CallWithOpts(ctx context.Context, inputs []contextwindow.Record, opts contextwindow.CallModelOpts) ([]contextwindow.Record, int, error) {
+	system, messages := claudeMessages(inputs)
+
+	req := claudeRequest{
+		Model:     c.model,
+		MaxTokens: claudeMaxTokens,
+		System:    system,
+		Messages:  messages,
+		Stream:    c.onDelta != nil && !isQuiet(ctx),
+	}
+
+	if !opts.DisableTools {
+		specs, err := toolSpecs(c.executor)
+		if err != nil {
+			return nil, 0, fmt.Errorf("claude: %w", err)
+		}
+		for _, spec := range specs {
+			schema := spec.Parameters
+			if len(schema) == 0 {
+				schema = json.RawMessage(`{"type":"object"}`)
+			}
+			req.Tools = append(req.Tools, claudeTool{
+				Name:        spec.Name,
+				Description: spec.Description,
+				InputSchema: schema,
+			})
+		}
+	}
+
+	var (
+		events []contextwindow.Record
+		tokens int
+	)
+
+	for {
+		resp, err := c.send(ctx, req)
+		if err != nil {
+			return nil, 0, err
+		}
+		tokens += resp.Usage.InputTokens + resp.Usage.OutputTokens
+
+		var (
+			uses    []claudeBlock
+			results []claudeBlock
+		)
+		for _, block := range resp.Content {
+			if block.Type == "tool_use" {
+				if len(block.Input) == 0 {
+					block.Input = json.RawMessage("{}")
+				}
+				uses = append(uses, block)
+			}
+		}
+
+		if len(uses) == 0 {
+			events = append(events, contextwindow.Record{
+				Source:  contextwindow.ModelResp,
+				Content: resp.text(),
+				Live:    true,
+			})
+			return events, tokens, nil
+		}
+
+		for _, use := range uses {
+			args := string(use.Input)
+			out := runTool(ctx, c.executor, c.middleware, use.Name, args)
+
+			results = append(results, claudeBlock{
+				Type:      "tool_result",
+				ToolUseID: use.ID,
+				Content:   &out,
+			})
+
+			call := fmt.Sprintf("%s(%s)", use.Name, args)
+			events = append(events,
+				contextwindow.Record{
+					Source:  contextwindow.ToolCall,
+					Content: call,
+					Live:    true,
+				},
+				contextwindow.Record{
+					Source:  contextwindow.ToolOutput,
+					Content: out,
+					Live:    true,
+				})
+		}
+
+		req.Messages = append(req.Messages,
+			claudeMessage{Role: "assistant", Content: resp.Content},
+			claudeMessage{Role: "user", Content: results})
+	}
+}
+
+// the system prompt is its own field, and the API wants user and
+// assistant turns to alternate, so neighbours with the same role are
+// merged. earlier tool calls go back as text, like chatMessages.
+func claudeMessages(inputs []contextwindow.Record) (string, []claudeMessage) {
+	var (
+		system   []string
+		messages []claudeMessage
+	)
+
+	for _, rec := range inputs {
+		var role string
+
+		switch rec.Source {
+		case contextwindow.SystemPrompt:
+			system = append(system, rec.Content)
+			continue
+		case contextwindow.Prompt, contextwindow.ToolOutput:
+			role = "user"
+		case contextwindow.ModelResp, contextwindow.ToolCall:
+			role = "assistant"
+		default:
+			continue
+		}
+
+		if rec.Content == "" {
+			continue
+		}
+
+		block := claudeBlock{Type: "text", Text: rec.Content}
+		if n := len(messages); n > 0 && messages[n-1].Role == role {
+			messages[n-1].Content = append(messages[n-1].Content, block)
+			continue
+		}
+		messages = append(messages, claudeMessage{Role: role, Content: []claudeBlock{block}})
+	}
+
+	return strings.Join(system, "\n\n"), messages
+}
+
+func (c *ClaudeModel) send(ctx context.Context, req claudeRequest) (*claudeResponse, error) {
+	headers := map[string]string{
+		"x-api-key":         c.apiKey,
+		"anthropic-version": claudeVersion,
+	}
+
+	resp, err := postJSON(ctx, c.client, c.baseURL+"/v1/messages", headers, req)
+	if err != nil {
+		return nil, fmt.Errorf("claude: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if isEventStream(resp) {
+		onDelta := c.onDelta
+		if !req.Stream {
+			onDelta = nil
+		}
+		return readClaudeStream(resp.Body, onDelta)
+	}
+
+	var cr claudeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
+		return nil, fmt.Errorf("claude: decode response: %w", err)
+	}
+
+	return &cr, nil
+}
+
+type claudeEvent struct {
+	Type         string       `json:"type"`
+	Index        int          `json:"index"`
+	ContentBlock *claudeBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+	} `json:"delta"`
+	Message *struct {
+		Usage claudeUsage `json:"usage"`
+	} `json:"message"`
+	Usage *claudeUsage `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// content blocks are opened, filled in by deltas, and closed; tool
+// inputs arrive as pieces of JSON to be put back together.
+func readClaudeStream(r io.Reader, onDelta func(string)) (*claudeResponse, error) {
+	var (
+		resp   claudeResponse
+		inputs = map[int]*strings.Builder{}
+	)
+
+	err := scanEvents(r, func(data string) error {
+		var ev claudeEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return fmt.Errorf("decode stream: %w", err)
+		}
+
+		switch ev.Type {
+		case "message_start":
+			if ev.Message != nil {
+				resp.Usage.InputTokens = ev.Message.Usage.InputTokens
+			}
+		case "content_block_start":
+			for len(resp.Content) <= ev.Index {
+				resp.Content = append(resp.Content, claudeBlock{})
+			}
+			if ev.ContentBlock != nil {
+				block := *ev.ContentBlock
+				block.Input = nil
+				resp.Content[ev.Index] = block
+			}
+			if ev.ContentBlock != nil && ev.ContentBlock.Type == "tool_use" {
+				inputs[ev.Index] = &strings.Builder{}
+			}
+		case "content_block_delta":
+			if ev.Index >= len(resp.Content) {
+				return fmt.Errorf("delta for unknown block %d", ev.Index)
+			}
+			switch ev.Delta.Type {
+			case "text_delta":
+				resp.Content[ev.Index].Text += ev.Delta.Text
+				if onDelta != nil && ev.Delta.Text != "" {
+					onDelta(ev.Delta.Text)
+				}
+			case "input_json_delta":
+				if b, ok := inputs[ev.Index]; ok {
+					b.WriteString(ev.Delta.PartialJSON)
+				}
+			}
+		case "message_delta":
+			if ev.Usage != nil {
+				resp.Usage.OutputTokens = ev.Usage.OutputTokens
+			}
+		case "message_stop":
+			return errStreamDone
+		case "error":
+			if ev.Error != nil {
+				return fmt.Errorf("%s", ev.Error.Message)
+			}
+			return fmt.Errorf("stream error")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("claude: %w", err)
+	}
+
+	for i, b := range inputs {
+		if b.Len() > 0 {
+			resp.Content[i].Input = json.RawMessage(b.String())
+		}
+	}
+
+	return &resp, nil
+}
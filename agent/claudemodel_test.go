@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/superfly/contextwindow"
+)
+
+func TestClaudeModelToolLoop(t *testing.T) {
+	var requests []claudeRequest
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "sk-ant", r.Header.Get("x-api-key"))
+		assert.Equal(t, claudeVersion, r.Header.Get("anthropic-version"))
+
+		var req claudeRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(requests) == 1 {
+			fmt.Fprint(w, `{"content":[{"type":"text","text":"checking"},
+				{"type":"tool_use","id":"toolu_1","name":"ping","input":{"host":"pg-7"}}],
+				"usage":{"input_tokens":8,"output_tokens":2}}`)
+			return
+		}
+		fmt.Fprint(w, `{"content":[{"type":"text","text":"pg-7 is up"}],
+			"usage":{"input_tokens":30,"output_tokens":2}}`)
+	}))
+	defer srv.Close()
+
+	model, err := NewClaudeModel(srv.URL+"/", "sk-ant", ClaudeHaiku45)
+	assert.NoError(t, err)
+
+	tools := &echoTools{}
+	model.SetToolExecutor(tools)
+
+	events, tokens, err := model.Call(context.Background(), []contextwindow.Record{
+		{Source: contextwindow.SystemPrompt, Content: "be brief"},
+		{Source: contextwindow.Prompt, Content: "is pg-7 up?"},
+		{Source: contextwindow.Prompt, Content: "quickly"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 42, tokens)
+
+	assert.Equal(t, []string{`ping {"host":"pg-7"}`}, tools.calls)
+	assert.Len(t, events, 3)
+	assert.Equal(t, `ping({"host":"pg-7"})`, events[0].Content)
+	assert.Equal(t, "pong from ping", events[1].Content)
+	assert.Equal(t, "pg-7 is up", events[2].Content)
+
+	assert.Len(t, requests, 2)
+	first := requests[0]
+	assert.Equal(t, ClaudeHaiku45, first.Model)
+	assert.Equal(t, "be brief", first.System)
+	assert.Len(t, first.Messages, 1)
+	assert.Len(t, first.Messages[0].Content, 2)
+	assert.Len(t, first.Tools, 1)
+	assert.Equal(t, "ping", first.Tools[0].Name)
+	assert.NotEmpty(t, first.Tools[0].InputSchema)
+
+	msgs := requests[1].Messages
+	assert.Equal(t, "assistant", msgs[1].Role)
+	assert.Equal(t, "tool_use", msgs[1].Content[1].Type)
+	assert.Equal(t, "user", msgs[2].Role)
+	assert.Equal(t, "tool_result", msgs[2].Content[0].Type)
+	assert.Equal(t, "toolu_1", msgs[2].Content[0].ToolUseID)
+	assert.Equal(t, "pong from ping", *msgs[2].Content[0].Content)
+}
+
+func TestClaudeModelStreaming(t *testing.T) {
+	var calls int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req claudeRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.True(t, req.Stream)
+		calls++
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":10}}}\n\n")
+
+		if calls == 1 {
+			fmt.Fprint(w, "data: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":"+
+				"{\"type\":\"tool_use\",\"id\":\"toolu_1\",\"name\":\"ping\",\"input\":{}}}\n\n")
+			for _, piece := range []string{`{"host":`, `"pg-7"}`} {
+				fmt.Fprintf(w, "data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":"+
+					"{\"type\":\"input_json_delta\",\"partial_json\":%q}}\n\n", piece)
+			}
+		} else {
+			fmt.Fprint(w, "data: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n")
+			for _, piece := range []string{"disk ", "is ", "full"} {
+				fmt.Fprintf(w, "data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":"+
+					"{\"type\":\"text_delta\",\"text\":%q}}\n\n", piece)
+			}
+		}
+
+		fmt.Fprint(w, "data: {\"type\":\"content_block_stop\",\"index\":0}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"message_delta\",\"usage\":{\"output_tokens\":11}}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"message_stop\"}\n\n")
+	}))
+	defer srv.Close()
+
+	model, err := NewClaudeModel(srv.URL, "sk-ant", ClaudeSonnet45)
+	assert.NoError(t, err)
+
+	tools := &echoTools{}
+	model.SetToolExecutor(tools)
+
+	var deltas []string
+	model.SetOnDelta(func(d string) { deltas = append(deltas, d) })
+
+	events, tokens, err := model.Call(context.Background(), []contextwindow.Record{
+		{Source: contextwindow.Prompt, Content: "why is pg-7 slow?"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 42, tokens)
+	assert.Equal(t, []string{`ping {"host":"pg-7"}`}, tools.calls)
+	assert.Equal(t, "disk is full", events[len(events)-1].Content)
+	assert.Equal(t, "disk is full", strings.Join(deltas, ""))
+}
+
+func TestClaudeModelSummaryDoesNotStream(t *testing.T) {
+	var streamed []bool
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req claudeRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		streamed = append(streamed, req.Stream)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"content":[{"type":"text","text":"pg-7 disk full"}]}`)
+	}))
+	defer srv.Close()
+
+	model, err := NewClaudeModel(srv.URL, "sk-ant", ClaudeHaiku45)
+	assert.NoError(t, err)
+	model.SetOnDelta(func(string) {})
+
+	_, _, err = model.Call(quietCall(context.Background()), []contextwindow.Record{
+		{Source: contextwindow.Prompt, Content: "summarize"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false}, streamed)
+}
@@ -0,0 +1,314 @@
+package agent
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/shlex"
+)
+
+type templateSegment struct {
+	text     string
+	optional bool
+}
+
+// for each [optional] [--flag], we need to see if we have the
+// needed {params} to expand it, otherwise zap the whole
+// [--optional flag].
+//
+// ie, for "tcpdump tcp [and port {port}]", when {port}
+// is optional.
+//
+// brackets inside quotes are literal, so "jq '.[0]'" survives.
+func splitOptional(cmd string) []templateSegment {
+	var (
+		segs  []templateSegment
+		cur   strings.Builder
+		quote rune
+		inOpt bool
+	)
+
+	flush := func(optional bool) {
+		if cur.Len() > 0 {
+			segs = append(segs, templateSegment{
+				text:     cur.String(),
+				optional: optional,
+			})
+		}
+		cur.Reset()
+	}
+
+	for _, r := range cmd {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '[' && !inOpt:
+			flush(false)
+			inOpt = true
+			continue
+		case r == ']' && inOpt:
+			flush(true)
+			inOpt = false
+			continue
+		}
+
+		cur.WriteRune(r)
+	}
+
+	flush(inOpt)
+
+	return segs
+}
+
+func renderValue(v any) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case []any:
+		parts := make([]string, len(v))
+		for i, e := range v {
+			parts[i] = renderValue(e)
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// substitute {params} into a single token; the result stays a
+// single argv element no matter what the value contains, except
+// that a token that is exactly one {array} becomes one argument per
+// element. a token made only of absent optional params is dropped,
+// as is one made only of booleans inside an [optional] group, where
+// the boolean just switches the group on.
+func expandToken(
+	token string,
+	params map[string]ToolParameter,
+	args map[string]any,
+	inGroup bool,
+) []string {
+	if m := paramRegex.FindStringSubmatch(token); m != nil && m[0] == token {
+		list, isList := args[m[1]].([]any)
+		if _, declared := params[m[1]]; declared && isList {
+			argv := make([]string, len(list))
+			for i, e := range list {
+				argv[i] = renderValue(e)
+			}
+			return argv
+		}
+	}
+
+	var elided, present int
+
+	out := paramRegex.ReplaceAllStringFunc(token, func(match string) string {
+		name := match[1 : len(match)-1]
+		if _, declared := params[name]; !declared {
+			return match
+		}
+
+		value, ok := args[name]
+		if !ok || value == nil {
+			elided++
+			return ""
+		}
+
+		if _, isBool := value.(bool); isBool && inGroup {
+			elided++
+			return ""
+		}
+
+		present++
+		return renderValue(value)
+	})
+
+	if elided > 0 && present == 0 && out == "" {
+		return nil
+	}
+
+	return []string{out}
+}
+
+func validateArgs(params map[string]ToolParameter, args map[string]any) error {
+	for name, param := range params {
+		value, ok := args[name]
+		if !ok || value == nil {
+			if param.Required {
+				return fmt.Errorf("required parameter %s not provided", name)
+			}
+			continue
+		}
+
+		if err := param.validate(value); err != nil {
+			return fmt.Errorf("parameter %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (p ToolParameter) validate(value any) error {
+	switch p.Type {
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("expected a string, got %v", value)
+		}
+
+	case "number":
+		switch value.(type) {
+		case float64, float32, int, int64:
+		default:
+			return fmt.Errorf("expected a number, got %v", value)
+		}
+
+	case "integer":
+		f, ok := value.(float64)
+		if !ok || f != math.Trunc(f) {
+			return fmt.Errorf("expected an integer, got %v", value)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("expected true or false, got %v", value)
+		}
+
+	case "enum":
+		s, _ := value.(string)
+		if !slices.Contains(p.Values, s) {
+			return fmt.Errorf("expected one of %s, got %v",
+				strings.Join(p.Values, ", "), value)
+		}
+
+	case "array":
+		list, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("expected a list of strings, got %v", value)
+		}
+		for _, e := range list {
+			if _, ok := e.(string); !ok {
+				return fmt.Errorf("expected a list of strings, got element %v", e)
+			}
+		}
+	}
+
+	return nil
+}
+
+// an [optional] group is dropped unless every {param} in it is
+// present and every boolean in it is true. a group holding an
+// {array} is repeated once per element, so "[--tag {tags}]" becomes
+// "--tag a --tag b".
+func expandGroup(
+	text string,
+	params map[string]ToolParameter,
+	args map[string]any,
+) ([]map[string]any, bool) {
+	if !hasAllParameters(text, args) {
+		return nil, false
+	}
+
+	var (
+		listName string
+		list     []any
+	)
+
+	for _, m := range paramRegex.FindAllStringSubmatch(text, -1) {
+		if _, declared := params[m[1]]; !declared {
+			continue
+		}
+
+		switch v := args[m[1]].(type) {
+		case nil:
+			return nil, false
+		case bool:
+			if !v {
+				return nil, false
+			}
+		case []any:
+			if len(v) == 0 {
+				return nil, false
+			}
+			if listName == "" {
+				listName, list = m[1], v
+			}
+		}
+	}
+
+	if listName == "" {
+		return []map[string]any{args}, true
+	}
+
+	var ret []map[string]any
+	for _, e := range list {
+		each := maps.Clone(args)
+		each[listName] = e
+		ret = append(ret, each)
+	}
+
+	return ret, true
+}
+
+func expandCommand(
+	cmd string,
+	params map[string]ToolParameter,
+	args map[string]any,
+) ([]string, error) {
+	if err := validateArgs(params, args); err != nil {
+		return nil, err
+	}
+
+	var argv []string
+
+	for _, seg := range splitOptional(cmd) {
+		tokens, err := shlex.Split(seg.text)
+		if err != nil {
+			return nil, fmt.Errorf("split command template: %w", err)
+		}
+
+		groups := []map[string]any{args}
+		if seg.optional {
+			var ok bool
+			if groups, ok = expandGroup(seg.text, params, args); !ok {
+				continue
+			}
+		}
+
+		for _, groupArgs := range groups {
+			for _, token := range tokens {
+				argv = append(argv,
+					expandToken(token, params, groupArgs, seg.optional)...)
+			}
+		}
+	}
+
+	return argv, nil
+}
+
+func ShellJoin(argv []string) string {
+	sb := &strings.Builder{}
+
+	for i, arg := range argv {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+
+		if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`|&;<>()*?[]{}#~") {
+			sb.WriteString(arg)
+			continue
+		}
+
+		sb.WriteString("'" + strings.ReplaceAll(arg, "'", `'\''`) + "'")
+	}
+
+	return sb.String()
+}
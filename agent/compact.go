@@ -0,0 +1,237 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peterheb/gotoken"
+	_ "github.com/peterheb/gotoken/cl100kbase"
+	"github.com/superfly/contextwindow"
+)
+
+const compactPrompt = `You're summarizing part of a longer conversation between
+a user, an assistant, and the tools the assistant called, so the
+excerpt can be dropped from the assistant's context window.
+
+*Rely strictly on the included text.* Write the summary in Markdown
+and prioritize concision, but keep every concrete fact the assistant
+may need later: hostnames, IDs, file paths, commands that were run and
+what they showed, conclusions reached, and open questions.
+
+Reply with the summary only.`
+
+type CompactResult struct {
+	Replaced      int
+	OrigTokens    int
+	SummaryTokens int
+}
+
+func (r CompactResult) String() string {
+	return fmt.Sprintf("Replaced %d records (%d tokens) with a summary (%d tokens).",
+		r.Replaced, r.OrigTokens, r.SummaryTokens)
+}
+
+// start and end are indices into LiveRecords, inclusive, like
+// SetRecordLiveStateByRange. the originals stay in the database,
+// just not live.
+func (a *Agent) Compact(ctx context.Context, start, end int) (CompactResult, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.compact(ctx, start, end)
+}
+
+func (a *Agent) compact(ctx context.Context, start, end int) (CompactResult, error) {
+	var res CompactResult
+
+	records, err := a.context.LiveRecords()
+	if err != nil {
+		return res, fmt.Errorf("compact: %w", err)
+	}
+
+	if start < 0 || end < start || end >= len(records) {
+		return res, fmt.Errorf("compact: invalid range %d-%d (have %d records)",
+			start, end, len(records))
+	}
+
+	originals := records[start : end+1]
+
+	summary, err := a.summarize(ctx, originals)
+	if err != nil {
+		return res, fmt.Errorf("compact: %w", err)
+	}
+
+	content := fmt.Sprintf("%s\"%d earlier records\">\n%s\n</summary>",
+		summaryPrefix, len(originals), strings.TrimSpace(summary))
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		return res, fmt.Errorf("compact: %w", err)
+	}
+	defer tx.Rollback()
+
+	// slot the summary in where the originals were, a nanosecond ahead
+	// of the first one so the two don't tie on ts.
+	res.SummaryTokens = tokenCount(content)
+	_, err = tx.Exec(
+		`INSERT INTO records (context_id, ts, source, content, live, est_tokens)
+		 VALUES (?, ?, ?, ?, 1, ?)`,
+		originals[0].ContextID, originals[0].Timestamp.UTC().Add(-time.Nanosecond),
+		int(contextwindow.ModelResp), content, res.SummaryTokens,
+	)
+	if err != nil {
+		return res, fmt.Errorf("compact: insert summary: %w", err)
+	}
+
+	for _, r := range originals {
+		if _, err := tx.Exec(`UPDATE records SET live = 0 WHERE id = ?`, r.ID); err != nil {
+			return res, fmt.Errorf("compact: retire record %d: %w", r.ID, err)
+		}
+		res.OrigTokens += r.EstTokens
+	}
+
+	if err := tx.Commit(); err != nil {
+		return res, fmt.Errorf("compact: %w", err)
+	}
+
+	res.Replaced = len(originals)
+
+	return res, nil
+}
+
+const summaryPrefix = "<summary of="
+
+// what the model said, without the wrapping compact puts around it.
+func summaryText(content string) string {
+	_, text, _ := strings.Cut(content, "\n")
+	return strings.TrimSuffix(text, "\n</summary>")
+}
+
+func (a *Agent) summarize(ctx context.Context, records []contextwindow.Record) (string, error) {
+	buf := &strings.Builder{}
+
+	fmt.Fprintf(buf, "%s\n\n<excerpt>\n", compactPrompt)
+	for _, r := range records {
+		fmt.Fprintf(buf, "<%s>\n%s\n</%s>\n",
+			recordLabel(r.Source), r.Content, recordLabel(r.Source))
+	}
+	fmt.Fprintf(buf, "</excerpt>\n")
+
+	input := []contextwindow.Record{{
+		Source:  contextwindow.Prompt,
+		Content: buf.String(),
+	}}
+
+	var (
+		events []contextwindow.Record
+		err    error
+	)
+	if a.summarizer != nil {
+		events, _, err = a.summarizer.Call(ctx, input)
+	} else {
+		events, _, err = a.model.CallWithOpts(quietCall(ctx), input,
+			contextwindow.CallModelOpts{DisableTools: true})
+	}
+	if err != nil {
+		return "", fmt.Errorf("summarize: %w", err)
+	}
+
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Source == contextwindow.ModelResp {
+			return events[i].Content, nil
+		}
+	}
+
+	return "", fmt.Errorf("summarize: model returned no response")
+}
+
+// the same estimate contextwindow makes when it inserts a record.
+func tokenCount(s string) int {
+	tokOnce.Do(func() {
+		tok, tokErr = gotoken.GetTokenizer("cl100k_base")
+	})
+	if tokErr != nil {
+		return len(strings.Fields(s))
+	}
+	return tok.Count(s)
+}
+
+var (
+	tok     gotoken.Tokenizer
+	tokOnce sync.Once
+	tokErr  error
+)
+
+func recordLabel(source contextwindow.RecordType) string {
+	switch source {
+	case contextwindow.Prompt:
+		return "user"
+	case contextwindow.ModelResp:
+		return "assistant"
+	case contextwindow.ToolCall:
+		return "tool_call"
+	case contextwindow.ToolOutput:
+		return "tool_output"
+	}
+	return "system"
+}
+
+type Compact struct {
+	agent *Agent
+}
+
+func NewCompact(agent *Agent) *Compact {
+	return &Compact{agent: agent}
+}
+
+func (c *Compact) ToolDescription() string {
+	return `
+name = "compact"
+description = """
+Replace a range of elements in the "live" context window with a
+summary of them, to save space without losing the thread. The
+originals are kept out of the context window but not destroyed.
+
+Elements are numbered starting at 0. Use the "review" tool to identify
+a range to compact; older, bulky tool output is a good candidate.
+"""
+
+[parameters]
+start = { type = "number", description = "first element to summarize", required = true }
+end = { type = "number", description = "last element to summarize", required = true }
+`
+}
+
+func (c *Compact) Init(cw *contextwindow.ContextWindow) error {
+	return nil
+}
+
+func (c *Compact) Run(ctx context.Context, rawargs json.RawMessage) (string, error) {
+	args := map[string]any{}
+	if err := json.Unmarshal(rawargs, &args); err != nil {
+		return "", err
+	}
+
+	start, ok := mapGet[float64](args, "start")
+	if !ok {
+		return "", fmt.Errorf("must provide 'start' parameter")
+	}
+
+	end, ok := mapGet[float64](args, "end")
+	if !ok {
+		return "", fmt.Errorf("must provide 'end' parameter")
+	}
+
+	// we're called from inside a model turn, which already holds
+	// the agent lock.
+	res, err := c.agent.compact(ctx, int(start), int(end))
+	if err != nil {
+		return "", err
+	}
+
+	return res.String() + "\n", nil
+}
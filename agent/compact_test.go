@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/superfly/contextwindow"
+)
+
+type summaryModel struct {
+	inputs []contextwindow.Record
+}
+
+func (m *summaryModel) Call(
+	ctx context.Context,
+	inputs []contextwindow.Record,
+) ([]contextwindow.Record, int, error) {
+	m.inputs = inputs
+	return []contextwindow.Record{{
+		Source:  contextwindow.ModelResp,
+		Content: "checked pg-7; disk full",
+		Live:    true,
+	}}, 10, nil
+}
+
+func TestCompact(t *testing.T) {
+	db := testDB(t)
+	model := &summaryModel{}
+
+	ag, err := NewAgent(db, model, "compact")
+	assert.NoError(t, err)
+
+	info, err := ag.GetContextWindow().GetCurrentContextInfo()
+	assert.NoError(t, err)
+
+	for _, content := range []string{"first", "second", "third", "fourth"} {
+		_, err := contextwindow.InsertRecord(db, info.ID,
+			contextwindow.Prompt, content, true)
+		assert.NoError(t, err)
+	}
+
+	res, err := ag.Compact(context.Background(), 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, res.Replaced)
+
+	assert.Len(t, model.inputs, 1)
+	assert.Contains(t, model.inputs[0].Content, "<user>\nsecond\n</user>")
+	assert.NotContains(t, model.inputs[0].Content, "fourth")
+
+	live, err := ag.GetContextWindow().LiveRecords()
+	assert.NoError(t, err)
+
+	var contents []string
+	for _, r := range live {
+		contents = append(contents, r.Content)
+	}
+	assert.Len(t, contents, 3)
+	assert.Equal(t, "first", contents[0])
+	assert.True(t, strings.HasPrefix(contents[1], "<summary"))
+	assert.Contains(t, contents[1], "disk full")
+	assert.Equal(t, "fourth", contents[2])
+
+	all, err := contextwindow.ListRecordsInContext(db, info.ID)
+	assert.NoError(t, err)
+	assert.Len(t, all, 5)
+
+	_, err = ag.Compact(context.Background(), 2, 5)
+	assert.Error(t, err)
+}
+
+func TestCompactOrderingWithTiedTimestamps(t *testing.T) {
+	db := testDB(t)
+
+	ag, err := NewAgent(db, &summaryModel{}, "compact")
+	assert.NoError(t, err)
+
+	info, err := ag.GetContextWindow().GetCurrentContextInfo()
+	assert.NoError(t, err)
+
+	for _, content := range []string{"first", "second", "third", "fourth"} {
+		_, err := contextwindow.InsertRecord(db, info.ID,
+			contextwindow.Prompt, content, true)
+		assert.NoError(t, err)
+	}
+
+	_, err = db.Exec(`UPDATE records SET ts = (SELECT ts FROM records WHERE content = 'second')
+		WHERE content IN ('third', 'fourth')`)
+	assert.NoError(t, err)
+
+	_, err = ag.Compact(context.Background(), 1, 2)
+	assert.NoError(t, err)
+
+	live, err := ag.GetContextWindow().LiveRecords()
+	assert.NoError(t, err)
+	assert.Len(t, live, 3)
+	assert.Equal(t, "first", live[0].Content)
+	assert.True(t, strings.HasPrefix(live[1].Content, "<summary"))
+	assert.Equal(t, "fourth", live[2].Content)
+	assert.True(t, live[1].Timestamp.Before(live[2].Timestamp))
+}
+
+func TestCompactFailureLeavesContextAlone(t *testing.T) {
+	db := testDB(t)
+
+	ag, err := NewAgent(db, &summaryModel{}, "compact")
+	assert.NoError(t, err)
+
+	info, err := ag.GetContextWindow().GetCurrentContextInfo()
+	assert.NoError(t, err)
+
+	for _, content := range []string{"first", "second", "third"} {
+		_, err := contextwindow.InsertRecord(db, info.ID,
+			contextwindow.Prompt, content, true)
+		assert.NoError(t, err)
+	}
+
+	_, err = db.Exec(`CREATE TRIGGER no_retire BEFORE UPDATE OF live ON records
+		BEGIN SELECT RAISE(FAIL, 'no'); END`)
+	assert.NoError(t, err)
+
+	_, err = ag.Compact(context.Background(), 0, 1)
+	assert.Error(t, err)
+
+	all, err := contextwindow.ListRecordsInContext(db, info.ID)
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+	for _, r := range all {
+		assert.True(t, r.Live)
+		assert.False(t, strings.HasPrefix(r.Content, "<summary"))
+	}
+}
@@ -0,0 +1,178 @@
+package agent
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// config.toml sets flags by name, the way you'd pass them:
+//
+//	model = "claude"
+//	maxtokens = 100000
+//
+//	[profile.oncall]
+//	model-name = "claude-sonnet-4-5"
+//	tools = "oncall-tools.toml"
+//	system = "oncall.md"
+//
+// a profile's settings go on top of the top-level ones, and flags on
+// the command line beat both.
+type Config struct {
+	Path    string
+	Options map[string]string
+}
+
+// flags that name files; relative paths in the config are relative to
+// the config file.
+var configPathFlags = map[string]bool{
+	"system": true,
+	"tools":  true,
+	"db":     true,
+}
+
+// $XDG_CONFIG_HOME/smiley/config.toml if there is one, otherwise
+// ~/.ctxagent/config.toml.
+func DefaultConfigPath() string {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		path := filepath.Join(xdg, "smiley", "config.toml")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".ctxagent", "config.toml")
+}
+
+// LoadConfig reads the config at path with profile (or the config's
+// default-profile) layered on top. a missing config file is only an
+// error if it was asked for by name, or a profile was.
+func LoadConfig(path, profile string, explicit bool) (*Config, error) {
+	c := &Config{Path: path, Options: map[string]string{}}
+
+	var raw map[string]any
+
+	_, err := toml.DecodeFile(path, &raw)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		if profile != "" {
+			return nil, fmt.Errorf("profile %s: no config file at %s", profile, path)
+		}
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+
+	profiles, _ := raw["profile"].(map[string]any)
+	delete(raw, "profile")
+
+	if profile == "" {
+		profile, _ = raw["default-profile"].(string)
+	}
+	delete(raw, "default-profile")
+
+	layers := []map[string]any{raw}
+
+	if profile != "" {
+		p, ok := profiles[profile].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("config %s: no [profile.%s] (have: %s)",
+				path, profile, strings.Join(sortedKeys(profiles), ", "))
+		}
+		layers = append(layers, p)
+	}
+
+	dir := filepath.Dir(path)
+
+	for _, layer := range layers {
+		for name, v := range layer {
+			if name == "config" || name == "profile" {
+				return nil, fmt.Errorf("config %s: unknown option %q", path, name)
+			}
+
+			value := configValue(v)
+			if configPathFlags[name] {
+				value = configFilePath(dir, value)
+			}
+			c.Options[name] = value
+		}
+	}
+
+	return c, nil
+}
+
+// Apply sets fs's flags from the config, skipping the ones that were
+// set on the command line. with strict, an option fs has no flag for
+// is an error; without it, it's left for whoever does, so subcommands
+// can share the agent's config.
+func (c *Config) Apply(fs *flag.FlagSet, strict bool) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for _, name := range sortedKeys(c.Options) {
+		if fs.Lookup(name) == nil {
+			if strict {
+				return fmt.Errorf("config %s: unknown option %q", c.Path, name)
+			}
+			continue
+		}
+
+		if set[name] {
+			continue
+		}
+
+		if err := fs.Set(name, c.Options[name]); err != nil {
+			return fmt.Errorf("config %s: %s: %w", c.Path, name, err)
+		}
+	}
+
+	return nil
+}
+
+func configValue(v any) string {
+	if list, ok := v.([]any); ok {
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, ",")
+	}
+
+	return fmt.Sprint(v)
+}
+
+func configFilePath(dir, path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(dir, path)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"flag"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func configFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("smiley", flag.ContinueOnError)
+	fs.String("model", "openai", "")
+	fs.String("model-name", "", "")
+	fs.String("tools", "", "")
+	fs.String("db", "", "")
+	fs.Int("maxtokens", 60_000, "")
+	return fs
+}
+
+const testConfig = `
+model = "claude"
+maxtokens = 100000
+tools = "tools.toml"
+db = "/var/lib/smiley.db"
+
+[profile.oncall]
+model-name = "claude-sonnet-4-5"
+tools = "oncall/tools.toml"
+
+[profile.local]
+model = "openai-compatible"
+`
+
+func TestConfigProfileLayering(t *testing.T) {
+	dir := t.TempDir()
+	path := writeToolConfig(t, dir, "config.toml", testConfig)
+
+	cfg, err := LoadConfig(path, "oncall", true)
+	assert.NoError(t, err)
+
+	fs := configFlagSet()
+	assert.NoError(t, cfg.Apply(fs, true))
+
+	assert.Equal(t, "claude", fs.Lookup("model").Value.String())
+	assert.Equal(t, "claude-sonnet-4-5", fs.Lookup("model-name").Value.String())
+	assert.Equal(t, "100000", fs.Lookup("maxtokens").Value.String())
+	assert.Equal(t, filepath.Join(dir, "oncall/tools.toml"), fs.Lookup("tools").Value.String())
+	assert.Equal(t, "/var/lib/smiley.db", fs.Lookup("db").Value.String())
+
+	cfg, err = LoadConfig(path, "", true)
+	assert.NoError(t, err)
+
+	fs = configFlagSet()
+	assert.NoError(t, cfg.Apply(fs, true))
+	assert.Equal(t, "", fs.Lookup("model-name").Value.String())
+	assert.Equal(t, filepath.Join(dir, "tools.toml"), fs.Lookup("tools").Value.String())
+
+	_, err = LoadConfig(path, "weekend", true)
+	assert.ErrorContains(t, err, "no [profile.weekend] (have: local, oncall)")
+}
+
+func TestConfigDefaultProfile(t *testing.T) {
+	path := writeToolConfig(t, t.TempDir(), "config.toml",
+		`default-profile = "local"`+"\n"+testConfig)
+
+	cfg, err := LoadConfig(path, "", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "openai-compatible", cfg.Options["model"])
+
+	cfg, err = LoadConfig(path, "oncall", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "claude", cfg.Options["model"])
+}
+
+func TestConfigFlagsWin(t *testing.T) {
+	path := writeToolConfig(t, t.TempDir(), "config.toml", testConfig)
+
+	cfg, err := LoadConfig(path, "local", true)
+	assert.NoError(t, err)
+
+	fs := configFlagSet()
+	assert.NoError(t, fs.Parse([]string{"-model", "fake", "-maxtokens", "500"}))
+	assert.NoError(t, cfg.Apply(fs, true))
+
+	assert.Equal(t, "fake", fs.Lookup("model").Value.String())
+	assert.Equal(t, "500", fs.Lookup("maxtokens").Value.String())
+	assert.Equal(t, "/var/lib/smiley.db", fs.Lookup("db").Value.String())
+}
+
+func TestConfigPaths(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	dir := t.TempDir()
+	assert.Equal(t, filepath.Join(dir, "system.md"), configFilePath(dir, "system.md"))
+	assert.Equal(t, filepath.Join(home, "tools.toml"), configFilePath(dir, "~/tools.toml"))
+	assert.Equal(t, "/etc/tools.toml", configFilePath(dir, "/etc/tools.toml"))
+	assert.Equal(t, "", configFilePath(dir, ""))
+
+	// only options that name files are paths.
+	path := writeToolConfig(t, dir, "config.toml", `
+system = "~/system.md"
+model-name = "models/qwen"
+`)
+	cfg, err := LoadConfig(path, "", true)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(home, "system.md"), cfg.Options["system"])
+	assert.Equal(t, "models/qwen", cfg.Options["model-name"])
+}
+
+func TestConfigUnknownOptions(t *testing.T) {
+	dir := t.TempDir()
+
+	path := writeToolConfig(t, dir, "config.toml", `
+model = "claude"
+modle-name = "typo"
+`)
+	cfg, err := LoadConfig(path, "", true)
+	assert.NoError(t, err)
+	assert.ErrorContains(t, cfg.Apply(configFlagSet(), true), `unknown option "modle-name"`)
+
+	// a subcommand only takes what it has flags for.
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	fs.String("model", "", "")
+	assert.NoError(t, cfg.Apply(fs, false))
+	assert.Equal(t, "claude", fs.Lookup("model").Value.String())
+
+	path = writeToolConfig(t, dir, "nested.toml", `
+[profile.oncall]
+profile = "local"
+`)
+	_, err = LoadConfig(path, "oncall", true)
+	assert.ErrorContains(t, err, `unknown option "profile"`)
+
+	path = writeToolConfig(t, dir, "bad.toml", `maxtokens = "lots"`)
+	cfg, err = LoadConfig(path, "", true)
+	assert.NoError(t, err)
+	assert.ErrorContains(t, cfg.Apply(configFlagSet(), true), "maxtokens")
+}
+
+func TestConfigMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+
+	cfg, err := LoadConfig(path, "", false)
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.Options)
+
+	_, err = LoadConfig(path, "oncall", false)
+	assert.ErrorContains(t, err, "profile oncall: no config file")
+
+	_, err = LoadConfig(path, "", true)
+	assert.Error(t, err)
+}
@@ -0,0 +1,260 @@
+package agent
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/superfly/contextwindow"
+)
+
+// the agent's own tables key on context name, so they have to follow
+// a context through renames, deletes, and forks.
+
+func (a *Agent) RenameContext(oldName, newName string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if newName == "" {
+		return fmt.Errorf("rename: new name cannot be empty")
+	}
+
+	if _, err := contextwindow.GetContextByName(a.db, newName); err == nil {
+		return fmt.Errorf("rename: context %s already exists", newName)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("rename: %w", err)
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, q := range []string{
+		`UPDATE contexts SET name = ? WHERE name = ?`,
+		`UPDATE todos SET context = ? WHERE context = ?`,
+		`UPDATE notes SET scope = ? WHERE scope = ?`,
+		`UPDATE artifacts SET context = ? WHERE context = ?`,
+		`UPDATE context_models SET context = ? WHERE context = ?`,
+		`UPDATE context_settings SET context = ? WHERE context = ?`,
+	} {
+		if _, err := tx.Exec(q, newName, oldName); err != nil {
+			return fmt.Errorf("rename %s: %w", oldName, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+
+	if a.context.GetCurrentContext() == oldName {
+		return a.context.SwitchContext(newName)
+	}
+
+	return nil
+}
+
+func (a *Agent) DeleteContext(name string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.context.GetCurrentContext() == name {
+		return fmt.Errorf("delete: %s is the current conversation", name)
+	}
+
+	if err := a.context.DeleteContext(name); err != nil {
+		return err
+	}
+
+	for _, q := range []string{
+		`DELETE FROM todos WHERE context = ?`,
+		`DELETE FROM notes WHERE scope = ?`,
+		`DELETE FROM artifacts WHERE context = ?`,
+		`DELETE FROM context_models WHERE context = ?`,
+		`DELETE FROM context_settings WHERE context = ?`,
+	} {
+		if _, err := a.db.Exec(q, name); err != nil {
+			return fmt.Errorf("delete %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (a *Agent) ForkContext(from, to string) error {
+	if err := contextwindow.CloneContext(a.db, from, to); err != nil {
+		return fmt.Errorf("fork %s: %w", from, err)
+	}
+
+	return copyContextState(a.db, from, to)
+}
+
+func copyContextState(db *sql.DB, from, to string) error {
+	if err := NewTodoStore(db).Copy(from, to); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(
+		`INSERT INTO notes (scope, key, value, updated_at)
+		 SELECT ?, key, value, updated_at FROM notes WHERE scope = ?`,
+		to, from,
+	)
+	if err != nil {
+		return fmt.Errorf("copy notes: %w", err)
+	}
+
+	// the fork's records point at the same handles.
+	_, err = db.Exec(
+		`INSERT INTO artifacts (id, context, tool, created_at, content)
+		 SELECT id, ?, tool, created_at, content FROM artifacts WHERE context = ?`,
+		to, from,
+	)
+	if err != nil {
+		return fmt.Errorf("copy artifacts: %w", err)
+	}
+
+	_, err = db.Exec(
+		`INSERT OR REPLACE INTO context_models (context, model, updated_at)
+		 SELECT ?, model, updated_at FROM context_models WHERE context = ?`,
+		to, from,
+	)
+	if err != nil {
+		return fmt.Errorf("copy model: %w", err)
+	}
+
+	_, err = db.Exec(
+		`INSERT OR REPLACE INTO context_settings
+		 (context, system_prompt, tools_path, model, base_url, max_tokens, updated_at)
+		 SELECT ?, system_prompt, tools_path, model, base_url, max_tokens, updated_at
+		 FROM context_settings WHERE context = ?`,
+		to, from,
+	)
+	if err != nil {
+		return fmt.Errorf("copy settings: %w", err)
+	}
+
+	return nil
+}
+
+type ContextSummary struct {
+	Name        string
+	Created     time.Time
+	LastActive  time.Time
+	LiveTokens  int
+	TotalTokens int
+	LiveRecords int
+	Records     int
+	Model       string
+}
+
+func (s ContextSummary) Empty() bool {
+	return s.LiveTokens == 0
+}
+
+// LastActive is zero for a context with no records; Model is empty
+// until a turn in the context has finished.
+func (a *Agent) ContextSummaries() ([]ContextSummary, error) {
+	contexts, err := a.context.ListContexts()
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []ContextSummary
+
+	for _, c := range contexts {
+		stats, err := a.context.GetContextStats(c)
+		if err != nil {
+			return nil, fmt.Errorf("stats for %s: %w", c.Name, err)
+		}
+
+		sum := ContextSummary{
+			Name:        c.Name,
+			Created:     c.StartTime,
+			LiveTokens:  stats.LiveTokens,
+			LiveRecords: stats.LiveRecords,
+			Records:     stats.TotalRecords,
+		}
+
+		if stats.LastActivity != nil {
+			sum.LastActive = *stats.LastActivity
+		}
+
+		err = a.db.QueryRow(
+			`SELECT COALESCE(SUM(est_tokens), 0) FROM records WHERE context_id = ?`,
+			c.ID,
+		).Scan(&sum.TotalTokens)
+		if err != nil {
+			return nil, fmt.Errorf("tokens for %s: %w", c.Name, err)
+		}
+
+		err = a.db.QueryRow(
+			`SELECT model FROM context_models WHERE context = ?`, c.Name,
+		).Scan(&sum.Model)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("model for %s: %w", c.Name, err)
+		}
+
+		ret = append(ret, sum)
+	}
+
+	return ret, nil
+}
+
+func (a *Agent) recordModel() {
+	name := a.ModelName()
+	if name == "" {
+		return
+	}
+
+	_, err := a.db.Exec(
+		`INSERT OR REPLACE INTO context_models (context, model, updated_at)
+		 VALUES (?, ?, ?)`,
+		a.ContextName(), name, time.Now().UTC(),
+	)
+	if err != nil {
+		slog.Error("record model", "error", err)
+	}
+}
+
+// names of contexts whose name contains query, or with a record that
+// has every word of it. the content side goes through records_fts, and
+// the last word matches as a prefix, since the history filter asks
+// as you type.
+func (a *Agent) MatchContexts(query string) (map[string]bool, error) {
+	like := "%" + query + "%"
+
+	match := ftsQuery(query)
+	if match == "" {
+		match = `""`
+	} else {
+		match += "*"
+	}
+
+	rows, err := a.db.Query(
+		`SELECT name FROM contexts WHERE name LIKE ?
+		 UNION
+		 SELECT c.name FROM records_fts
+		 JOIN records r ON r.id = records_fts.rowid
+		 JOIN contexts c ON c.id = r.context_id
+		 WHERE records_fts MATCH ?`,
+		like, match,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("match contexts: %w", err)
+	}
+	defer rows.Close()
+
+	ret := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan context: %w", err)
+		}
+		ret[name] = true
+	}
+
+	return ret, rows.Err()
+}
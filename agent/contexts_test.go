@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/superfly/contextwindow"
+)
+
+func TestContextManagement(t *testing.T) {
+	db := testDB(t)
+
+	ag, err := NewAgent(db, nil, "incident")
+	assert.NoError(t, err)
+
+	info, err := ag.GetContextWindow().GetCurrentContextInfo()
+	assert.NoError(t, err)
+	_, err = contextwindow.InsertRecord(db, info.ID,
+		contextwindow.Prompt, "why is pg-7 slow", true)
+	assert.NoError(t, err)
+	assert.NoError(t, ag.Todos().Add("incident", "check disk"))
+	assert.NoError(t, ag.Notes().Save("incident", "host", "pg-7"))
+
+	assert.NoError(t, ag.ForkContext("incident", "incident-2"))
+	todos, err := ag.Todos().List("incident-2")
+	assert.NoError(t, err)
+	assert.Len(t, todos, 1)
+	note, err := ag.Notes().Recall("incident-2", "host")
+	assert.NoError(t, err)
+	assert.Equal(t, "pg-7", note.Value)
+
+	assert.Error(t, ag.RenameContext("incident", "incident-2"))
+	assert.NoError(t, ag.RenameContext("incident", "pg-7-slow"))
+	assert.Equal(t, "pg-7-slow", ag.ContextName())
+	todos, err = ag.Todos().List("pg-7-slow")
+	assert.NoError(t, err)
+	assert.Len(t, todos, 1)
+
+	matches, err := ag.MatchContexts("slow")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"pg-7-slow": true, "incident-2": true}, matches)
+
+	assert.Error(t, ag.DeleteContext("pg-7-slow"))
+	assert.NoError(t, ag.DeleteContext("incident-2"))
+	todos, err = ag.Todos().List("incident-2")
+	assert.NoError(t, err)
+	assert.Empty(t, todos)
+
+	matches, err = ag.MatchContexts("pg-7")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"pg-7-slow": true}, matches)
+}
+
+func TestMatchContextsByContent(t *testing.T) {
+	db := testDB(t)
+
+	ag, err := NewAgent(db, nil, "incident")
+	assert.NoError(t, err)
+
+	info, err := ag.GetContextWindow().GetCurrentContextInfo()
+	assert.NoError(t, err)
+	_, err = contextwindow.InsertRecord(db, info.ID,
+		contextwindow.ToolOutput, "zookeeper on zk-3 lost quorum", true)
+	assert.NoError(t, err)
+
+	// quotes aren't FTS syntax here.
+	for _, query := range []string{"zookeeper", "quorum zk-3", "zookeeper quo", "ZooKeeper", `"zoo`} {
+		matches, err := ag.MatchContexts(query)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]bool{"incident": true}, matches, query)
+	}
+
+	// every word, but in any order.
+	matches, err := ag.MatchContexts("quorum kafka")
+	assert.NoError(t, err)
+	assert.Empty(t, matches)
+
+	matches, err = ag.MatchContexts("  ")
+	assert.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestContextSummaries(t *testing.T) {
+	db := testDB(t)
+
+	ag, err := NewAgent(db, &summaryModel{}, "busy")
+	assert.NoError(t, err)
+	ag.SetModelName("openai/gpt-test")
+
+	_, err = ag.RunPrompt("hello")
+	assert.NoError(t, err)
+
+	_, err = contextwindow.CreateContext(db, "empty")
+	assert.NoError(t, err)
+
+	assert.NoError(t, ag.ForkContext("busy", "busy-fork"))
+	_, err = ag.SetRecordRangeLive(0, 0, false)
+	assert.NoError(t, err)
+
+	sums, err := ag.ContextSummaries()
+	assert.NoError(t, err)
+
+	byName := map[string]ContextSummary{}
+	for _, s := range sums {
+		byName[s.Name] = s
+	}
+
+	busy := byName["busy"]
+	assert.Equal(t, "openai/gpt-test", busy.Model)
+	assert.Equal(t, 2, busy.Records)
+	assert.Equal(t, 1, busy.LiveRecords)
+	assert.Less(t, busy.LiveTokens, busy.TotalTokens)
+	assert.False(t, busy.LastActive.IsZero())
+	assert.False(t, busy.Empty())
+
+	assert.Equal(t, "openai/gpt-test", byName["busy-fork"].Model)
+
+	assert.True(t, byName["empty"].Empty())
+	assert.True(t, byName["empty"].LastActive.IsZero())
+	assert.Equal(t, "", byName["empty"].Model)
+}
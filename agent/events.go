@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"time"
+)
+
+type Event struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Context string    `json:"context"`
+	Data    any       `json:"data"`
+}
+
+type toolCallEvent struct {
+	Name     string `json:"name"`
+	Args     string `json:"args,omitempty"`
+	Complete bool   `json:"complete"`
+	Size     int    `json:"size,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type modelResponseEvent struct {
+	Response string `json:"response"`
+}
+
+type modelDeltaEvent struct {
+	Delta string `json:"delta"`
+}
+
+type tokenUsageEvent struct {
+	Usage float64 `json:"usage"`
+}
+
+type workingEvent struct {
+	Working bool `json:"working"`
+}
+
+type errorEvent struct {
+	Error string `json:"error"`
+}
+
+type pressureEvent struct {
+	Strategy string  `json:"strategy"`
+	Usage    float64 `json:"usage"`
+	Msg      string  `json:"msg"`
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func NewEvent(contextName string, msg Message) (Event, bool) {
+	ev := Event{
+		Time:    time.Now().UTC(),
+		Context: contextName,
+	}
+
+	switch msg := msg.(type) {
+	case ToolCallMsg:
+		ev.Type = "tool_call"
+		ev.Data = toolCallEvent{
+			Name:     msg.Name,
+			Args:     msg.Args,
+			Complete: msg.Complete,
+			Size:     msg.Size,
+			Error:    errString(msg.Err),
+		}
+	case ModelResponseMsg:
+		ev.Type = "model_response"
+		ev.Data = modelResponseEvent{Response: msg.Response}
+	case ModelDeltaMsg:
+		ev.Type = "model_delta"
+		ev.Data = modelDeltaEvent{Delta: msg.Delta}
+	case TokenUsageMsg:
+		ev.Type = "token_usage"
+		ev.Data = tokenUsageEvent{Usage: msg.Usage}
+	case WorkingMsg:
+		ev.Type = "working"
+		ev.Data = workingEvent{Working: msg.Working}
+	case ErrorMsg:
+		ev.Type = "error"
+		ev.Data = errorEvent{Error: errString(msg.Err)}
+	case PressureMsg:
+		ev.Type = "pressure"
+		ev.Data = pressureEvent{
+			Strategy: string(msg.Strategy),
+			Usage:    msg.Usage,
+			Msg:      msg.Msg,
+		}
+	case CancelledMsg:
+		ev.Type = "cancelled"
+		ev.Data = struct{}{}
+	default:
+		return ev, false
+	}
+
+	return ev, true
+}
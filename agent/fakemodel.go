@@ -0,0 +1,205 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/superfly/contextwindow"
+	"gopkg.in/yaml.v3"
+)
+
+// FakeModel plays back a script instead of calling an LLM; each call
+// to the model is the next turn of the script. a fixture looks like:
+//
+//	turns:
+//	  - expect: pg-7
+//	    tool_calls:
+//	      - name: ping
+//	        args: {host: pg-7}
+//	    response: pg-7 is up.
+//	    tokens: 120
+//	  - error: rate limited
+//
+// expect, if set, has to appear in the latest prompt, so a test fails
+// where the conversation goes off script rather than somewhere later.
+type FakeModel struct {
+	lock  sync.Mutex
+	turns []FakeTurn
+	next  int
+
+	executor   contextwindow.ToolExecutor
+	middleware []contextwindow.Middleware
+	onDelta    func(string)
+}
+
+// Prompt and Output are only used by replays; the model itself
+// ignores them.
+type FakeTurn struct {
+	Prompt    string         `yaml:"prompt,omitempty"`
+	Expect    string         `yaml:"expect,omitempty"`
+	ToolCalls []FakeToolCall `yaml:"tool_calls,omitempty"`
+	Response  string         `yaml:"response"`
+	Tokens    int            `yaml:"tokens,omitempty"`
+	Error     string         `yaml:"error,omitempty"`
+}
+
+type FakeToolCall struct {
+	Name   string         `yaml:"name"`
+	Args   map[string]any `yaml:"args,omitempty"`
+	Output string         `yaml:"output,omitempty"`
+}
+
+// Summaries are what the model said when asked to compact, in the
+// order it was asked; replays hand them back instead of spending a
+// turn on each.
+type Fixture struct {
+	Context   string     `yaml:"context,omitempty"`
+	Turns     []FakeTurn `yaml:"turns"`
+	Summaries []string   `yaml:"summaries,omitempty"`
+}
+
+var ErrScriptExhausted = errors.New("fake model: script exhausted")
+
+func NewFakeModel(turns []FakeTurn) *FakeModel {
+	return &FakeModel{turns: turns}
+}
+
+func LoadFixture(path string) (*Fixture, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load fixture: %w", err)
+	}
+
+	var fx Fixture
+	if err := yaml.Unmarshal(buf, &fx); err != nil {
+		return nil, fmt.Errorf("load fixture %s: %w", path, err)
+	}
+
+	if len(fx.Turns) == 0 {
+		return nil, fmt.Errorf("load fixture %s: no turns", path)
+	}
+
+	for i, t := range fx.Turns {
+		for j, tc := range t.ToolCalls {
+			if tc.Name == "" {
+				return nil, fmt.Errorf("load fixture %s: turn %d: tool call %d has no name",
+					path, i+1, j+1)
+			}
+		}
+	}
+
+	return &fx, nil
+}
+
+func LoadFakeModel(path string) (*FakeModel, error) {
+	fx, err := LoadFixture(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFakeModel(fx.Turns), nil
+}
+
+func (f *FakeModel) SetToolExecutor(e contextwindow.ToolExecutor) {
+	f.executor = e
+}
+
+func (f *FakeModel) SetMiddleware(mw []contextwindow.Middleware) {
+	f.middleware = mw
+}
+
+func (f *FakeModel) SetOnDelta(fn func(string)) {
+	f.onDelta = fn
+}
+
+// how many turns have been played.
+func (f *FakeModel) Played() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.next
+}
+
+func (f *FakeModel) Call(ctx context.Context, inputs []contextwindow.Record) ([]contextwindow.Record, int, error) {
+	return f.CallWithOpts(ctx, inputs, contextwindow.CallModelOpts{})
+}
+
+func (f *FakeModel) CallWithOpts(ctx context.Context, inputs []contextwindow.Record, opts contextwindow.CallModelOpts) ([]contextwindow.Record, int, error) {
+	f.lock.Lock()
+	if f.next >= len(f.turns) {
+		f.lock.Unlock()
+		return nil, 0, fmt.Errorf("%w after %d turns", ErrScriptExhausted, len(f.turns))
+	}
+	turn := f.turns[f.next]
+	f.next++
+	n := f.next
+	f.lock.Unlock()
+
+	if turn.Expect != "" {
+		if prompt := lastPrompt(inputs); !strings.Contains(prompt, turn.Expect) {
+			return nil, 0, fmt.Errorf("fake model: turn %d: expected prompt containing %q, got %q",
+				n, turn.Expect, prompt)
+		}
+	}
+
+	if turn.Error != "" {
+		return nil, 0, fmt.Errorf("fake model: turn %d: %s", n, turn.Error)
+	}
+
+	var events []contextwindow.Record
+
+	for _, tc := range turn.ToolCalls {
+		if opts.DisableTools {
+			break
+		}
+
+		args, err := json.Marshal(tc.Args)
+		if err != nil {
+			return nil, 0, fmt.Errorf("fake model: turn %d: %s args: %w", n, tc.Name, err)
+		}
+
+		out := runTool(ctx, f.executor, f.middleware, tc.Name, string(args))
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+
+		call := fmt.Sprintf("%s(%s)", tc.Name, args)
+		events = append(events,
+			contextwindow.Record{
+				Source:  contextwindow.ToolCall,
+				Content: call,
+				Live:    true,
+			},
+			contextwindow.Record{
+				Source:  contextwindow.ToolOutput,
+				Content: out,
+				Live:    true,
+			})
+	}
+
+	if f.onDelta != nil {
+		f.onDelta(turn.Response)
+	}
+
+	events = append(events, contextwindow.Record{
+		Source:  contextwindow.ModelResp,
+		Content: turn.Response,
+		Live:    true,
+	})
+
+	return events, turn.Tokens, nil
+}
+
+func lastPrompt(inputs []contextwindow.Record) string {
+	for i := len(inputs) - 1; i >= 0; i-- {
+		if inputs[i].Source == contextwindow.Prompt {
+			return inputs[i].Content
+		}
+	}
+	return ""
+}
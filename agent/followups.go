@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"regexp"
+	"strings"
+)
+
+// the system prompt asks the model to end with suggested next steps
+// in a <FOLLOWUP> block, one "(Fn) description" per option.
+type Followup struct {
+	Key         string
+	Description string
+}
+
+func ParseFollowups(text string) []Followup {
+	startIdx := strings.Index(text, "<FOLLOWUP>")
+	endIdx := strings.Index(text, "</FOLLOWUP>")
+
+	if startIdx == -1 || endIdx == -1 || endIdx < startIdx {
+		return nil
+	}
+
+	content := text[startIdx+10 : endIdx]
+
+	re := regexp.MustCompile(`\(F[0-9]+\)`)
+	matches := re.FindAllStringIndex(content, -1)
+
+	if len(matches) == 0 {
+		return nil
+	}
+
+	options := []Followup{}
+
+	for i, match := range matches {
+		key := content[match[0]+1 : match[1]-1]
+
+		var description string
+		if i < len(matches)-1 {
+			description = content[match[1]:matches[i+1][0]]
+		} else {
+			description = content[match[1]:]
+		}
+
+		description = strings.TrimSpace(description)
+
+		options = append(options, Followup{
+			Key:         key,
+			Description: description,
+		})
+
+		if len(options) >= 9 {
+			break
+		}
+	}
+
+	return options
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"regexp"
 )
 
+var artifactHandleRegex = regexp.MustCompile(`^<artifact handle="([^"]+)" bytes="(\d+)"`)
+
 type agentMiddleware struct {
 	agent *Agent
 }
@@ -29,6 +32,8 @@ func (am *agentMiddleware) OnToolResult(ctx context.Context, name, result string
 	var msg string
 	if err != nil {
 		msg = fmt.Sprintf("%s: error: %s", name, err.Error())
+	} else if m := artifactHandleRegex.FindStringSubmatch(result); m != nil {
+		msg = fmt.Sprintf("%s: (%s bytes, stored as %s)", name, m[2], m[1])
 	} else {
 		msg = fmt.Sprintf("%s: (%d bytes)", name, len(result))
 	}
@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/superfly/contextwindow"
+)
+
+// waits out any turn in progress; the next turn goes to m, with the
+// whole conversation. the conversation keeps m when it's resumed.
+func (a *Agent) SetModel(name string, m contextwindow.Model) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.model.set(name, m)
+
+	if err := a.SaveSettings(); err != nil {
+		slog.Error("save settings", "error", err)
+	}
+}
+
+func (a *Agent) lastRecordID() int64 {
+	var id int64
+
+	err := a.db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM records`).Scan(&id)
+	if err != nil {
+		slog.Error("last record id", "error", err)
+	}
+
+	return id
+}
+
+// tags the responses added to the current context since record id
+// since with the model that produced them.
+func (a *Agent) recordResponseModels(since int64) {
+	name := a.ModelName()
+	if name == "" {
+		return
+	}
+
+	info, err := a.context.GetCurrentContextInfo()
+	if err != nil {
+		slog.Error("record response models", "error", err)
+		return
+	}
+
+	_, err = a.db.Exec(
+		`INSERT OR REPLACE INTO response_models (record_id, model)
+		 SELECT id, ? FROM records
+		 WHERE context_id = ? AND id > ? AND source = ?`,
+		name, info.ID, since, contextwindow.ModelResp,
+	)
+	if err != nil {
+		slog.Error("record response models", "error", err)
+	}
+}
+
+// the model that produced each response in the current context, by
+// record id. responses from before we kept track aren't in the map.
+func (a *Agent) ResponseModels() (map[int64]string, error) {
+	info, err := a.context.GetCurrentContextInfo()
+	if err != nil {
+		return nil, fmt.Errorf("response models: %w", err)
+	}
+
+	rows, err := a.db.Query(
+		`SELECT m.record_id, m.model FROM response_models m
+		 JOIN records r ON r.id = m.record_id
+		 WHERE r.context_id = ?`,
+		info.ID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("response models: %w", err)
+	}
+	defer rows.Close()
+
+	ret := map[int64]string{}
+	for rows.Next() {
+		var (
+			id    int64
+			model string
+		)
+		if err := rows.Scan(&id, &model); err != nil {
+			return nil, fmt.Errorf("response models: %w", err)
+		}
+		ret[id] = model
+	}
+
+	return ret, rows.Err()
+}
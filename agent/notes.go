@@ -0,0 +1,218 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/superfly/contextwindow"
+)
+
+// notes saved with shared=true go in the global scope, which every
+// context can see; everything else is scoped to the context name.
+const globalNoteScope = ""
+
+type Note struct {
+	Scope     string
+	Key       string
+	Value     string
+	UpdatedAt time.Time
+}
+
+func (n Note) Shared() bool {
+	return n.Scope == globalNoteScope
+}
+
+type NoteStore struct {
+	db *sql.DB
+}
+
+func NewNoteStore(db *sql.DB) *NoteStore {
+	return &NoteStore{db: db}
+}
+
+func (s *NoteStore) Save(scope, key, value string) error {
+	_, err := s.db.Exec(
+		`INSERT INTO notes (scope, key, value, updated_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT (scope, key) DO UPDATE
+		 SET value = excluded.value, updated_at = excluded.updated_at`,
+		scope, key, value, time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("save note: %w", err)
+	}
+
+	return nil
+}
+
+// a context's own note shadows a shared note with the same key.
+func (s *NoteStore) Recall(contextName, key string) (Note, error) {
+	var n Note
+
+	err := s.db.QueryRow(
+		`SELECT scope, key, value, updated_at FROM notes
+		 WHERE key = ? AND scope IN (?, ?)
+		 ORDER BY scope = ? ASC LIMIT 1`,
+		key, contextName, globalNoteScope, globalNoteScope,
+	).Scan(&n.Scope, &n.Key, &n.Value, &n.UpdatedAt)
+	if err != nil {
+		return n, fmt.Errorf("recall note %s: %w", key, err)
+	}
+
+	return n, nil
+}
+
+func (s *NoteStore) List(contextName string) ([]Note, error) {
+	rows, err := s.db.Query(
+		`SELECT scope, key, value, updated_at FROM notes
+		 WHERE scope IN (?, ?) ORDER BY scope = ? ASC, key ASC`,
+		contextName, globalNoteScope, globalNoteScope,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list notes: %w", err)
+	}
+	defer rows.Close()
+
+	var ret []Note
+	for rows.Next() {
+		var n Note
+		if err := rows.Scan(&n.Scope, &n.Key, &n.Value, &n.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan note: %w", err)
+		}
+		ret = append(ret, n)
+	}
+
+	return ret, rows.Err()
+}
+
+func (s *NoteStore) Delete(scope, key string) error {
+	res, err := s.db.Exec(`DELETE FROM notes WHERE scope = ? AND key = ?`, scope, key)
+	if err != nil {
+		return fmt.Errorf("delete note: %w", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("no note %s", key)
+	}
+
+	return nil
+}
+
+func FormatNotes(notes []Note) string {
+	buf := &strings.Builder{}
+
+	for _, n := range notes {
+		scope := "context"
+		if n.Shared() {
+			scope = "shared"
+		}
+		fmt.Fprintf(buf, "%s (%s): %s\n", n.Key, scope, truncate(n.Value, 80))
+	}
+
+	return buf.String()
+}
+
+type Notes struct {
+	store *NoteStore
+	cw    *contextwindow.ContextWindow
+}
+
+func NewNotes(store *NoteStore) *Notes {
+	return &Notes{store: store}
+}
+
+func (n *Notes) ToolDescription() string {
+	return `
+name = "notes"
+description = """
+Save and recall named notes: findings, hostnames, incident IDs, anything
+worth remembering later. Notes are stored durably. By default a note
+belongs to this conversation; with "shared" set to true it is visible
+from every conversation, so a fresh conversation can pick it up.
+
+You MUST call this tool with an "action".
+
+"save" stores "value" under "key", replacing any existing note with that key.
+"recall" returns the note stored under "key"; this conversation's note wins over a shared one.
+"list" lists the keys of this conversation's notes and the shared notes.
+"delete" removes the note stored under "key".
+"""
+
+[parameters]
+action = { type = "string", description = "save, recall, list, or delete", required = true }
+key = { type = "string", description = "Name of the note", required = false }
+value = { type = "string", description = "Contents of the note, for save", required = false }
+shared = { type = "boolean", description = "Save or delete the note shared across all conversations", required = false }
+`
+}
+
+func (n *Notes) Init(cw *contextwindow.ContextWindow) error {
+	n.cw = cw
+	return nil
+}
+
+func (n *Notes) Run(ctx context.Context, rawargs json.RawMessage) (string, error) {
+	args := map[string]any{}
+	if err := json.Unmarshal(rawargs, &args); err != nil {
+		return "", err
+	}
+
+	action, ok := mapGet[string](args, "action")
+	if !ok {
+		return "", fmt.Errorf("no valid action")
+	}
+
+	contextName := n.cw.GetCurrentContext()
+
+	if action == "list" {
+		notes, err := n.store.List(contextName)
+		if err != nil {
+			return "", err
+		}
+		return "<notes>\n" + FormatNotes(notes) + "</notes>\n", nil
+	}
+
+	key, ok := mapGet[string](args, "key")
+	if !ok || key == "" {
+		return "", fmt.Errorf("must provide 'key' parameter")
+	}
+
+	scope := contextName
+	if shared, _ := mapGet[bool](args, "shared"); shared {
+		scope = globalNoteScope
+	}
+
+	switch action {
+	case "save":
+		value, ok := mapGet[string](args, "value")
+		if !ok {
+			return "", fmt.Errorf("must provide 'value' parameter")
+		}
+		if err := n.store.Save(scope, key, value); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("saved %s\n", key), nil
+
+	case "recall":
+		note, err := n.store.Recall(contextName, key)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Sprintf("no note %s\n", key), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return note.Value + "\n", nil
+
+	case "delete":
+		if err := n.store.Delete(scope, key); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("deleted %s\n", key), nil
+	}
+
+	return "", fmt.Errorf("invalid action %s", action)
+}
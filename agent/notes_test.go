@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runNotes(t *testing.T, n *Notes, args map[string]any) string {
+	raw, err := json.Marshal(args)
+	assert.NoError(t, err)
+	out, err := n.Run(context.Background(), raw)
+	assert.NoError(t, err)
+	return out
+}
+
+func TestNotesScopes(t *testing.T) {
+	db := testDB(t)
+
+	ag, err := NewAgent(db, nil, "monday")
+	assert.NoError(t, err)
+
+	notes := NewNotes(ag.Notes())
+	assert.NoError(t, notes.Init(ag.GetContextWindow()))
+
+	runNotes(t, notes, map[string]any{
+		"action": "save", "key": "db-host", "value": "pg-7", "shared": true,
+	})
+	runNotes(t, notes, map[string]any{
+		"action": "save", "key": "theory", "value": "disk is full",
+	})
+
+	assert.NoError(t, ag.SwitchContext("tuesday"))
+
+	out := runNotes(t, notes, map[string]any{"action": "recall", "key": "db-host"})
+	assert.Equal(t, "pg-7\n", out)
+
+	out = runNotes(t, notes, map[string]any{"action": "recall", "key": "theory"})
+	assert.Equal(t, "no note theory\n", out)
+
+	runNotes(t, notes, map[string]any{
+		"action": "save", "key": "db-host", "value": "pg-9",
+	})
+	out = runNotes(t, notes, map[string]any{"action": "recall", "key": "db-host"})
+	assert.Equal(t, "pg-9\n", out)
+
+	out = runNotes(t, notes, map[string]any{"action": "list"})
+	assert.Equal(t,
+		"<notes>\ndb-host (context): pg-9\ndb-host (shared): pg-7\n</notes>\n", out)
+
+	runNotes(t, notes, map[string]any{"action": "delete", "key": "db-host"})
+	out = runNotes(t, notes, map[string]any{"action": "recall", "key": "db-host"})
+	assert.Equal(t, "pg-7\n", out)
+}
@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/superfly/contextwindow"
+)
+
+type PressureStrategy string
+
+const (
+	PressureOff       PressureStrategy = ""
+	PressureDropTools PressureStrategy = "drop-tools"
+	PressureSummarize PressureStrategy = "summarize"
+	PressureWarn      PressureStrategy = "warn"
+)
+
+func ParsePressureStrategy(s string) (PressureStrategy, error) {
+	switch st := PressureStrategy(s); st {
+	case PressureOff, PressureDropTools, PressureSummarize, PressureWarn:
+		return st, nil
+	}
+
+	return PressureOff, fmt.Errorf("unknown pressure strategy %q "+
+		"(want drop-tools, summarize, or warn)", s)
+}
+
+// Threshold is a fraction of max tokens, like TokenUsage.Percent.
+type PressurePolicy struct {
+	Threshold float64
+	Strategy  PressureStrategy
+}
+
+type PressureMsg struct {
+	Strategy PressureStrategy
+	Usage    float64
+	Msg      string
+}
+
+func (a *Agent) SetPressurePolicy(p PressurePolicy) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.pressure = p
+}
+
+func (a *Agent) sendPressure(strategy PressureStrategy, usage float64, msg string) {
+	slog.Info("context pressure", "strategy", strategy, "usage", usage, "msg", msg)
+
+	if a.OnEvent != nil {
+		a.OnEvent(PressureMsg{Strategy: strategy, Usage: usage, Msg: msg})
+	}
+}
+
+// runs with the agent lock held, right before the model call. not in
+// the middle of the model's tool loop: the providers keep that turn's
+// history to themselves until they answer, so nothing we retire then
+// would change what they send. the most recent prompt, which started
+// this turn, is never touched.
+func (a *Agent) relievePressure(ctx context.Context) {
+	if a.pressure.Strategy == PressureOff || a.pressure.Threshold <= 0 {
+		return
+	}
+
+	usage, err := a.context.TokenUsage()
+	if err != nil || usage.Percent < a.pressure.Threshold {
+		a.pressureWarned = false
+		return
+	}
+
+	switch a.pressure.Strategy {
+	case PressureWarn:
+		if a.pressureWarned {
+			return
+		}
+		a.pressureWarned = true
+		a.sendPressure(PressureWarn, usage.Percent, fmt.Sprintf(
+			"Context is %.0f%% full (%d of %d tokens). "+
+				"Compact or lobotomize old records, or the model will start losing the thread.",
+			usage.Percent*100, usage.Live, usage.Max))
+
+	case PressureDropTools:
+		dropped, tokens, err := a.dropToolOutputs(usage)
+		if err != nil {
+			a.sendPressure(PressureDropTools, usage.Percent,
+				"dropping tool outputs failed: "+err.Error())
+			return
+		}
+		if dropped == 0 {
+			return
+		}
+		a.sendPressure(PressureDropTools, usage.Percent, fmt.Sprintf(
+			"Context was %.0f%% full; dropped the %d oldest tool outputs (%d tokens). "+
+				"They won't be sent to the model from this turn on.",
+			usage.Percent*100, dropped, tokens))
+
+	case PressureSummarize:
+		end, err := a.lastPromptIndex()
+		if err != nil || end < 2 {
+			return
+		}
+		res, err := a.compact(ctx, 0, end-1)
+		if err != nil {
+			a.sendPressure(PressureSummarize, usage.Percent,
+				"summarizing old turns failed: "+err.Error())
+			return
+		}
+		a.sendPressure(PressureSummarize, usage.Percent, fmt.Sprintf(
+			"Context was %.0f%% full; summarized everything before the current prompt. %s "+
+				"From this turn on, the model is sent the summary instead.",
+			usage.Percent*100, res))
+	}
+}
+
+func (a *Agent) lastPromptIndex() (int, error) {
+	records, err := a.context.LiveRecords()
+	if err != nil {
+		return 0, err
+	}
+
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Source == contextwindow.Prompt {
+			return i, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// retire tool outputs oldest-first until we're back under the
+// threshold or there are none left before the current prompt.
+func (a *Agent) dropToolOutputs(usage contextwindow.TokenUsage) (int, int, error) {
+	records, err := a.context.LiveRecords()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	end, err := a.lastPromptIndex()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	target := int(a.pressure.Threshold * float64(usage.Max))
+	live := usage.Live
+
+	var dropped, tokens int
+
+	for _, r := range records[:end] {
+		if live < target {
+			break
+		}
+		if r.Source != contextwindow.ToolOutput {
+			continue
+		}
+
+		if _, err := a.db.Exec(`UPDATE records SET live = 0 WHERE id = ?`, r.ID); err != nil {
+			return dropped, tokens, fmt.Errorf("retire record %d: %w", r.ID, err)
+		}
+
+		dropped++
+		tokens += r.EstTokens
+		live -= r.EstTokens
+	}
+
+	return dropped, tokens, nil
+}
@@ -0,0 +1,178 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/superfly/contextwindow"
+)
+
+func TestPressureDropTools(t *testing.T) {
+	db := testDB(t)
+
+	ag, err := NewAgent(db, &summaryModel{}, "pressure")
+	assert.NoError(t, err)
+
+	var events []PressureMsg
+	ag.OnEvent = func(msg Message) {
+		if pm, ok := msg.(PressureMsg); ok {
+			events = append(events, pm)
+		}
+	}
+
+	info, err := ag.GetContextWindow().GetCurrentContextInfo()
+	assert.NoError(t, err)
+
+	bulk := strings.Repeat("lorem ipsum dolor sit amet ", 100)
+	for _, r := range []struct {
+		source  contextwindow.RecordType
+		content string
+	}{
+		{contextwindow.Prompt, "check the logs"},
+		{contextwindow.ToolOutput, bulk},
+		{contextwindow.ToolOutput, bulk},
+		{contextwindow.ModelResp, "found it"},
+		{contextwindow.Prompt, "now what"},
+	} {
+		_, err := contextwindow.InsertRecord(db, info.ID, r.source, r.content, true)
+		assert.NoError(t, err)
+	}
+
+	usage, err := ag.GetContextWindow().TokenUsage()
+	assert.NoError(t, err)
+	ag.SetMaxTokens(usage.Live)
+
+	ag.SetPressurePolicy(PressurePolicy{Threshold: 0.8, Strategy: PressureDropTools})
+	ag.relievePressure(context.Background())
+
+	live, err := ag.GetContextWindow().LiveRecords()
+	assert.NoError(t, err)
+	assert.Len(t, live, 4)
+	assert.Equal(t, contextwindow.ToolOutput, live[1].Source)
+
+	assert.Len(t, events, 1)
+	assert.Contains(t, events[0].Msg, "dropped the 1 oldest tool outputs")
+}
+
+func TestPressureSummarizeAndWarn(t *testing.T) {
+	db := testDB(t)
+
+	ag, err := NewAgent(db, &summaryModel{}, "pressure")
+	assert.NoError(t, err)
+
+	var events []PressureMsg
+	ag.OnEvent = func(msg Message) {
+		if pm, ok := msg.(PressureMsg); ok {
+			events = append(events, pm)
+		}
+	}
+
+	info, err := ag.GetContextWindow().GetCurrentContextInfo()
+	assert.NoError(t, err)
+
+	for _, content := range []string{"one", "two", "three", "current"} {
+		_, err := contextwindow.InsertRecord(db, info.ID,
+			contextwindow.Prompt, content, true)
+		assert.NoError(t, err)
+	}
+
+	ag.SetMaxTokens(1)
+
+	ag.SetPressurePolicy(PressurePolicy{Threshold: 0.5, Strategy: PressureWarn})
+	ag.relievePressure(context.Background())
+	ag.relievePressure(context.Background())
+	assert.Len(t, events, 1)
+	assert.Equal(t, PressureWarn, events[0].Strategy)
+
+	ag.SetPressurePolicy(PressurePolicy{Threshold: 0.5, Strategy: PressureSummarize})
+	ag.relievePressure(context.Background())
+
+	live, err := ag.GetContextWindow().LiveRecords()
+	assert.NoError(t, err)
+	assert.Len(t, live, 2)
+	assert.Contains(t, live[0].Content, "<summary")
+	assert.Equal(t, "current", live[1].Content)
+	assert.Len(t, events, 2)
+}
+
+// remembers what the model was sent on each call.
+type sentModel struct {
+	*FakeModel
+	sent [][]contextwindow.Record
+}
+
+func (m *sentModel) Call(ctx context.Context, inputs []contextwindow.Record) ([]contextwindow.Record, int, error) {
+	return m.CallWithOpts(ctx, inputs, contextwindow.CallModelOpts{})
+}
+
+func (m *sentModel) CallWithOpts(ctx context.Context, inputs []contextwindow.Record, opts contextwindow.CallModelOpts) ([]contextwindow.Record, int, error) {
+	m.sent = append(m.sent, inputs)
+	return m.FakeModel.CallWithOpts(ctx, inputs, opts)
+}
+
+func TestPressureAfterToolLoop(t *testing.T) {
+	db := testDB(t)
+
+	dump := FakeToolCall{Name: "dump", Args: map[string]any{}}
+	model := &sentModel{FakeModel: NewFakeModel([]FakeTurn{
+		{ToolCalls: []FakeToolCall{dump, dump, dump}, Response: "that's a lot of lorem"},
+		{Expect: "and now?", Response: "all quiet"},
+	})}
+
+	ag, err := NewAgent(db, model, "pressure")
+	assert.NoError(t, err)
+
+	tools := writeToolConfig(t, t.TempDir(), "tools.toml", `
+[[tool]]
+name = "dump"
+description = "dump some lorem"
+command = "sh -c 'yes lorem ipsum | head -n 200'"
+`)
+	assert.NoError(t, ag.LoadTools(tools))
+
+	// under the threshold when the first turn starts, well over it
+	// once its three tool outputs are in.
+	ag.SetMaxTokens(4 * tokenCount(strings.Repeat("lorem ipsum\n", 200)))
+	ag.SetPressurePolicy(PressurePolicy{Threshold: 0.5, Strategy: PressureDropTools})
+
+	events := recordEvents(ag)
+
+	_, err = ag.RunPrompt("dump it all")
+	assert.NoError(t, err)
+	_, err = ag.RunPrompt("and now?")
+	assert.NoError(t, err)
+
+	// nothing happens inside the tool loop, where it would change
+	// nothing the model is sent.
+	var order []string
+	for _, e := range *events {
+		switch e := e.(type) {
+		case PressureMsg:
+			order = append(order, "pressure")
+		case ToolCallMsg:
+			if !e.Complete {
+				order = append(order, "call")
+			}
+		case ModelResponseMsg:
+			order = append(order, "response")
+		}
+	}
+	assert.Equal(t, []string{"call", "call", "call", "response", "pressure", "response"}, order)
+
+	outputs := func(inputs []contextwindow.Record) int {
+		n := 0
+		for _, r := range inputs {
+			if r.Source == contextwindow.ToolOutput {
+				n++
+			}
+		}
+		return n
+	}
+
+	assert.Len(t, model.sent, 2)
+	assert.Equal(t, 0, outputs(model.sent[0]))
+	assert.Equal(t, 1, outputs(model.sent[1]))
+	assert.Equal(t, "and now?", lastPrompt(model.sent[1]))
+}
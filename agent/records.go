@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/superfly/contextwindow"
+)
+
+// every record in the current context, live or dead, in timestamp
+// order. indices into this slice are what the transcript view and
+// /revive use.
+func (a *Agent) Records() ([]contextwindow.Record, error) {
+	info, err := a.context.GetCurrentContextInfo()
+	if err != nil {
+		return nil, fmt.Errorf("records: %w", err)
+	}
+
+	return contextwindow.ListRecordsInContext(a.db, info.ID)
+}
+
+func (a *Agent) SetRecordsLive(ids []int64, live bool) error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return fmt.Errorf("set records live: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if _, err := tx.Exec(`UPDATE records SET live = ? WHERE id = ?`, live, id); err != nil {
+			return fmt.Errorf("set record %d live: %w", id, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// like SetRecordLiveStateByRange, but start and end index Records
+// rather than LiveRecords, so dead records can be brought back.
+// returns how many records actually changed.
+func (a *Agent) SetRecordRangeLive(start, end int, live bool) (int, error) {
+	records, err := a.Records()
+	if err != nil {
+		return 0, err
+	}
+
+	if start < 0 || end < start || end >= len(records) {
+		return 0, fmt.Errorf("invalid range %d-%d (have %d records)",
+			start, end, len(records))
+	}
+
+	var ids []int64
+	for _, r := range records[start : end+1] {
+		if r.Live != live {
+			ids = append(ids, r.ID)
+		}
+	}
+
+	return len(ids), a.SetRecordsLive(ids, live)
+}
+
+func (a *Agent) DeleteRecords(ids []int64) error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return fmt.Errorf("delete records: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if _, err := tx.Exec(`DELETE FROM records WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("delete record %d: %w", id, err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/superfly/contextwindow"
+)
+
+func TestReviveRecords(t *testing.T) {
+	db := testDB(t)
+
+	ag, err := NewAgent(db, nil, "revive")
+	assert.NoError(t, err)
+
+	info, err := ag.GetContextWindow().GetCurrentContextInfo()
+	assert.NoError(t, err)
+
+	for _, content := range []string{"a", "b", "c", "d"} {
+		_, err := contextwindow.InsertRecord(db, info.ID,
+			contextwindow.Prompt, content, true)
+		assert.NoError(t, err)
+	}
+
+	lobo := &Lobotomize{}
+	assert.NoError(t, lobo.Init(ag.GetContextWindow()))
+	raw, _ := json.Marshal(map[string]any{"start": 1, "end": 2})
+	_, err = lobo.Run(context.Background(), raw)
+	assert.NoError(t, err)
+
+	live, err := ag.GetContextWindow().LiveRecords()
+	assert.NoError(t, err)
+	assert.Len(t, live, 2)
+
+	n, err := ag.SetRecordRangeLive(0, 2, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	all, err := ag.Records()
+	assert.NoError(t, err)
+	assert.Len(t, all, 4)
+	for _, r := range all {
+		assert.True(t, r.Live)
+	}
+
+	_, err = ag.SetRecordRangeLive(3, 4, true)
+	assert.Error(t, err)
+
+	assert.NoError(t, ag.DeleteRecords([]int64{all[0].ID}))
+	all, err = ag.Records()
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+	assert.Equal(t, "b", all[0].Content)
+}
@@ -0,0 +1,217 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/superfly/contextwindow"
+)
+
+// ExportFixture turns a recorded conversation into a script for the
+// fake model: a turn per prompt, with the tool calls the model made
+// and what they returned at the time. dead records count too, since
+// the model saw them when it made its choices.
+func ExportFixture(db *sql.DB, contextName string) (*Fixture, error) {
+	c, err := contextwindow.GetContextByName(db, contextName)
+	if err != nil {
+		return nil, fmt.Errorf("export %s: %w", contextName, err)
+	}
+
+	records, err := contextwindow.ListRecordsInContext(db, c.ID)
+	if err != nil {
+		return nil, fmt.Errorf("export %s: %w", contextName, err)
+	}
+
+	fx := &Fixture{Context: contextName}
+
+	// a summary sits where the records it replaced were, but its id
+	// says when it was made.
+	var summaries []contextwindow.Record
+
+	var turn *FakeTurn
+	for i, r := range records {
+		if r.Source == contextwindow.ModelResp && strings.HasPrefix(r.Content, summaryPrefix) {
+			summaries = append(summaries, r)
+			continue
+		}
+
+		if r.Source == contextwindow.Prompt {
+			fx.Turns = append(fx.Turns, FakeTurn{Prompt: r.Content})
+			turn = &fx.Turns[len(fx.Turns)-1]
+			continue
+		}
+
+		if turn == nil {
+			continue
+		}
+
+		switch r.Source {
+		case contextwindow.ToolCall:
+			tc, err := parseToolCall(r.Content)
+			if err != nil {
+				return nil, fmt.Errorf("export %s: record %d: %w", contextName, i, err)
+			}
+			turn.ToolCalls = append(turn.ToolCalls, tc)
+
+		case contextwindow.ToolOutput:
+			if n := len(turn.ToolCalls); n > 0 {
+				turn.ToolCalls[n-1].Output = r.Content
+			}
+
+		case contextwindow.ModelResp:
+			turn.Response = r.Content
+		}
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].ID < summaries[j].ID
+	})
+	for _, r := range summaries {
+		fx.Summaries = append(fx.Summaries, summaryText(r.Content))
+	}
+
+	if len(fx.Turns) == 0 {
+		return nil, fmt.Errorf("export %s: no prompts", contextName)
+	}
+
+	return fx, nil
+}
+
+// models record tool calls as name(json args).
+func parseToolCall(content string) (FakeToolCall, error) {
+	name, args, ok := strings.Cut(content, "(")
+	if !ok || !strings.HasSuffix(args, ")") {
+		return FakeToolCall{}, fmt.Errorf("malformed tool call %q", content)
+	}
+
+	tc := FakeToolCall{Name: name}
+
+	args = strings.TrimSuffix(args, ")")
+	if strings.TrimSpace(args) == "" {
+		return tc, nil
+	}
+
+	if err := json.Unmarshal([]byte(args), &tc.Args); err != nil {
+		return FakeToolCall{}, fmt.Errorf("tool call %s: args: %w", name, err)
+	}
+
+	return tc, nil
+}
+
+type ReplayMismatch struct {
+	Turn int
+	Tool string
+	Want string
+	Got  string
+}
+
+func (m ReplayMismatch) String() string {
+	return fmt.Sprintf("turn %d: %s: output changed\n--- recorded\n%s\n+++ replayed\n%s",
+		m.Turn, m.Tool, m.Want, m.Got)
+}
+
+// stands in for the model when a replay compacts, so summaries don't
+// eat the turns meant for prompts.
+type summaryStub struct {
+	lock      sync.Mutex
+	summaries []string
+}
+
+func (s *summaryStub) Call(ctx context.Context, inputs []contextwindow.Record) ([]contextwindow.Record, int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	content := "(no summary was recorded)"
+	if len(s.summaries) > 0 {
+		content, s.summaries = s.summaries[0], s.summaries[1:]
+	}
+
+	return []contextwindow.Record{{
+		Source:  contextwindow.ModelResp,
+		Content: content,
+		Live:    true,
+	}}, 0, nil
+}
+
+// Replay sends the fixture's prompts through the agent with the model
+// swapped for the fixture, so the tools run for real against the
+// model's recorded calls, and reports every tool whose output differs
+// from what was recorded.
+func (a *Agent) Replay(fx *Fixture) ([]ReplayMismatch, error) {
+	a.SetModel("fake/replay", NewFakeModel(fx.Turns))
+
+	a.lock.Lock()
+	a.summarizer = &summaryStub{summaries: fx.Summaries}
+	a.lock.Unlock()
+
+	defer func() {
+		a.lock.Lock()
+		a.summarizer = nil
+		a.lock.Unlock()
+	}()
+
+	var mismatches []ReplayMismatch
+
+	for i, turn := range fx.Turns {
+		// records come back in ts order, and a compaction slots its
+		// summary in among the old ones, so the turn's are told apart
+		// by id.
+		last := a.lastRecordID()
+
+		if _, err := a.RunPrompt(turn.Prompt); err != nil {
+			return mismatches, fmt.Errorf("replay turn %d: %w", i+1, err)
+		}
+
+		records, err := a.Records()
+		if err != nil {
+			return nil, err
+		}
+
+		var outputs []string
+		for _, r := range records {
+			if r.ID > last && r.Source == contextwindow.ToolOutput {
+				outputs = append(outputs, r.Content)
+			}
+		}
+
+		for j, tc := range turn.ToolCalls {
+			var got string
+			if j < len(outputs) {
+				got = outputs[j]
+			}
+			if !sameOutput(got, tc.Output) {
+				mismatches = append(mismatches, ReplayMismatch{
+					Turn: i + 1,
+					Tool: tc.Name,
+					Want: tc.Output,
+					Got:  got,
+				})
+			}
+		}
+	}
+
+	return mismatches, nil
+}
+
+var artifactHandle = regexp.MustCompile(`\bart-[0-9a-f]{8}\b`)
+
+// a spilled output's preview names an artifact handle that's made up
+// fresh each time, so handles don't count as a difference.
+func sameOutput(got, want string) bool {
+	if got == want {
+		return true
+	}
+
+	if !strings.HasPrefix(got, "<artifact ") || !strings.HasPrefix(want, "<artifact ") {
+		return false
+	}
+
+	return artifactHandle.ReplaceAllString(got, "art-") ==
+		artifactHandle.ReplaceAllString(want, "art-")
+}
@@ -0,0 +1,240 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func pingTools(t *testing.T, command string) string {
+	return writeToolConfig(t, t.TempDir(), "tools.toml", `
+[[tool]]
+name = "ping"
+description = "ping a host"
+command = "`+command+`"
+
+[tool.parameters]
+host = { description = "host", required = true }
+`)
+}
+
+func TestExportAndReplay(t *testing.T) {
+	db := testDB(t)
+
+	model, err := LoadFakeModel("testdata/investigate.yaml")
+	assert.NoError(t, err)
+
+	ag, err := NewAgent(db, model, "incident-42")
+	assert.NoError(t, err)
+	assert.NoError(t, ag.LoadTools(pingTools(t, "echo pong {host}")))
+
+	_, err = ag.RunPrompt("is pg-7 up?")
+	assert.NoError(t, err)
+
+	fx, err := ExportFixture(db, "incident-42")
+	assert.NoError(t, err)
+	assert.Equal(t, "incident-42", fx.Context)
+	assert.Len(t, fx.Turns, 1)
+	assert.Equal(t, "is pg-7 up?", fx.Turns[0].Prompt)
+	assert.Equal(t, []FakeToolCall{{
+		Name:   "ping",
+		Args:   map[string]any{"host": "pg-7"},
+		Output: "pong pg-7\n",
+	}}, fx.Turns[0].ToolCalls)
+	assert.Contains(t, fx.Turns[0].Response, "pg-7 answers pings")
+
+	buf, err := yaml.Marshal(fx)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "incident-42.yaml")
+	assert.NoError(t, os.WriteFile(path, buf, 0644))
+
+	fx, err = LoadFixture(path)
+	assert.NoError(t, err)
+
+	same, err := NewAgent(testDB(t), nil, "replay")
+	assert.NoError(t, err)
+	assert.NoError(t, same.LoadTools(pingTools(t, "echo pong {host}")))
+
+	mismatches, err := same.Replay(fx)
+	assert.NoError(t, err)
+	assert.Empty(t, mismatches)
+
+	changed, err := NewAgent(testDB(t), nil, "replay")
+	assert.NoError(t, err)
+	assert.NoError(t, changed.LoadTools(pingTools(t, "echo timeout {host}")))
+
+	mismatches, err = changed.Replay(fx)
+	assert.NoError(t, err)
+	assert.Equal(t, []ReplayMismatch{{
+		Turn: 1,
+		Tool: "ping",
+		Want: "pong pg-7\n",
+		Got:  "timeout pg-7\n",
+	}}, mismatches)
+
+	_, err = ExportFixture(db, "no-such-context")
+	assert.Error(t, err)
+}
+
+func TestParseToolCall(t *testing.T) {
+	tc, err := parseToolCall(`review()`)
+	assert.NoError(t, err)
+	assert.Equal(t, FakeToolCall{Name: "review"}, tc)
+
+	tc, err = parseToolCall(`grep({"pattern":"(a|b)"})`)
+	assert.NoError(t, err)
+	assert.Equal(t, "(a|b)", tc.Args["pattern"])
+
+	_, err = parseToolCall("not a call")
+	assert.Error(t, err)
+}
+
+func TestReplayWithCompaction(t *testing.T) {
+	db := testDB(t)
+
+	// the third turn is the model writing the summary compact asks for.
+	model := NewFakeModel([]FakeTurn{
+		{Response: "checking"},
+		{
+			ToolCalls: []FakeToolCall{{Name: "compact", Args: map[string]any{"start": 0, "end": 1}}},
+			Response:  "compacted",
+		},
+		{Response: "user asked to check pg-7"},
+	})
+
+	ag, err := NewAgent(db, model, "incident-43")
+	assert.NoError(t, err)
+	ag.RegisterBuiltinTool("compact", NewCompact(ag))
+	tools := writeToolConfig(t, t.TempDir(), "tools.toml", `
+[[tool]]
+name = "compact"
+builtin = true
+`)
+	assert.NoError(t, ag.LoadTools(tools))
+
+	_, err = ag.RunPrompt("check pg-7")
+	assert.NoError(t, err)
+	_, err = ag.RunPrompt("tidy up")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, model.Played())
+
+	fx, err := ExportFixture(db, "incident-43")
+	assert.NoError(t, err)
+	assert.Len(t, fx.Turns, 2)
+	assert.Equal(t, "compacted", fx.Turns[1].Response)
+	assert.Equal(t, []string{"user asked to check pg-7"}, fx.Summaries)
+
+	replay, err := NewAgent(testDB(t), nil, "replay")
+	assert.NoError(t, err)
+	replay.RegisterBuiltinTool("compact", NewCompact(replay))
+	assert.NoError(t, replay.LoadTools(tools))
+
+	mismatches, err := replay.Replay(fx)
+	assert.NoError(t, err)
+	assert.Empty(t, mismatches)
+
+	live, err := replay.GetContextWindow().LiveRecords()
+	assert.NoError(t, err)
+	assert.Contains(t, live[0].Content, "user asked to check pg-7")
+}
+
+func TestReplaySpilledOutput(t *testing.T) {
+	db := testDB(t)
+
+	model := NewFakeModel([]FakeTurn{{
+		ToolCalls: []FakeToolCall{{Name: "logs"}},
+		Response:  "lots of logs",
+	}})
+
+	ag, err := NewAgent(db, model, "incident-44")
+	assert.NoError(t, err)
+	tools := writeToolConfig(t, t.TempDir(), "tools.toml", `
+[[tool]]
+name = "logs"
+description = "fetch logs"
+command = "seq 1 100"
+spill_bytes = 64
+`)
+	assert.NoError(t, ag.LoadTools(tools))
+
+	_, err = ag.RunPrompt("show me the logs")
+	assert.NoError(t, err)
+
+	fx, err := ExportFixture(db, "incident-44")
+	assert.NoError(t, err)
+	assert.Contains(t, fx.Turns[0].ToolCalls[0].Output, "<artifact handle=")
+
+	replay, err := NewAgent(testDB(t), nil, "replay")
+	assert.NoError(t, err)
+	assert.NoError(t, replay.LoadTools(tools))
+
+	mismatches, err := replay.Replay(fx)
+	assert.NoError(t, err)
+	assert.Empty(t, mismatches)
+
+	assert.True(t, sameOutput(`<artifact handle="art-1a2b3c4d">`, `<artifact handle="art-9f8e7d6c">`))
+	assert.False(t, sameOutput(`<artifact handle="art-1a2b3c4d" lines="100">`, `<artifact handle="art-9f8e7d6c" lines="99">`))
+}
+
+func TestReplayCompactsMidTurn(t *testing.T) {
+	db := testDB(t)
+
+	// each compact takes a model turn to write its summary.
+	model := NewFakeModel([]FakeTurn{
+		{
+			ToolCalls: []FakeToolCall{{Name: "ping", Args: map[string]any{"host": "pg-7"}}},
+			Response:  "pg-7 is up",
+		},
+		{
+			ToolCalls: []FakeToolCall{
+				{Name: "compact", Args: map[string]any{"start": 0, "end": 0}},
+				{Name: "compact", Args: map[string]any{"start": 0, "end": 0}},
+			},
+			Response: "compacted",
+		},
+		{Response: "user asked about pg-7"},
+		{Response: "still about pg-7"},
+	})
+
+	ag, err := NewAgent(db, model, "incident-45")
+	assert.NoError(t, err)
+	ag.RegisterBuiltinTool("compact", NewCompact(ag))
+	tools := writeToolConfig(t, t.TempDir(), "tools.toml", `
+[[tool]]
+name = "compact"
+builtin = true
+
+[[tool]]
+name = "ping"
+description = "ping a host"
+command = "echo pong {host}"
+
+[tool.parameters]
+host = { description = "host", required = true }
+`)
+	assert.NoError(t, ag.LoadTools(tools))
+
+	_, err = ag.RunPrompt("is pg-7 up?")
+	assert.NoError(t, err)
+	_, err = ag.RunPrompt("tidy up")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, model.Played())
+
+	fx, err := ExportFixture(db, "incident-45")
+	assert.NoError(t, err)
+	assert.Len(t, fx.Turns[1].ToolCalls, 2)
+
+	// both summaries land before the first turn's tool output, which
+	// mustn't be taken for one of the second turn's.
+	replay, err := NewAgent(testDB(t), nil, "replay")
+	assert.NoError(t, err)
+	replay.RegisterBuiltinTool("compact", NewCompact(replay))
+	assert.NoError(t, replay.LoadTools(tools))
+
+	mismatches, err := replay.Replay(fx)
+	assert.NoError(t, err)
+	assert.Empty(t, mismatches)
+}
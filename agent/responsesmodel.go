@@ -0,0 +1,297 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/superfly/contextwindow"
+)
+
+const defaultOpenAIURL = "https://api.openai.com/v1"
+
+// ResponsesModel talks to OpenAI's Responses API with plain HTTP, so
+// that it can stream, which contextwindow's model can't. like
+// ChatModel, it sends the whole conversation every time rather than
+// threading on the server, and it doesn't stream the agent's own
+// calls.
+type ResponsesModel struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+
+	executor   contextwindow.ToolExecutor
+	middleware []contextwindow.Middleware
+	onDelta    func(string)
+}
+
+// an empty baseURL is OpenAI's.
+func NewResponsesModel(baseURL, apiKey, model string) (*ResponsesModel, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY not set")
+	}
+	if model == "" {
+		return nil, fmt.Errorf("responses model: no model name")
+	}
+	if baseURL == "" {
+		baseURL = defaultOpenAIURL
+	}
+
+	return &ResponsesModel{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  http.DefaultClient,
+	}, nil
+}
+
+func (r *ResponsesModel) SetToolExecutor(e contextwindow.ToolExecutor) {
+	r.executor = e
+}
+
+func (r *ResponsesModel) SetMiddleware(mw []contextwindow.Middleware) {
+	r.middleware = mw
+}
+
+func (r *ResponsesModel) SetOnDelta(fn func(string)) {
+	r.onDelta = fn
+}
+
+// a message when Role is set, otherwise a function call or its output.
+type responsesInput struct {
+	Type      string  `json:"type,omitempty"`
+	Role      string  `json:"role,omitempty"`
+	Content   *string `json:"content,omitempty"`
+	CallID    string  `json:"call_id,omitempty"`
+	Name      string  `json:"name,omitempty"`
+	Arguments string  `json:"arguments,omitempty"`
+	Output    *string `json:"output,omitempty"`
+}
+
+type responsesTool struct {
+	Type string `json:"type"`
+	toolSpec
+	Strict bool `json:"strict"`
+}
+
+type responsesRequest struct {
+	Model  string           `json:"model"`
+	Input  []responsesInput `json:"input"`
+	Tools  []responsesTool  `json:"tools,omitempty"`
+	Stream bool             `json:"stream,omitempty"`
+}
+
+type responsesOutput struct {
+	Type      string `json:"type"`
+	CallID    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Content   []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+type responsesResponse struct {
+	ID     string            `json:"id"`
+	Output []responsesOutput `json:"output"`
+	Usage  *struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+func (resp *responsesResponse) text() string {
+	var b strings.Builder
+	for _, o := range resp.Output {
+		if o.Type != "message" {
+			continue
+		}
+		for _, c := range o.Content {
+			if c.Type == "output_text" {
+				b.WriteString(c.Text)
+			}
+		}
+	}
+	return b.String()
+}
+
+func (resp *responsesResponse) tokens() int {
+	if resp.Usage == nil {
+		return 0
+	}
+	return resp.Usage.TotalTokens
+}
+
+func (r *ResponsesModel) Call(ctx context.Context, inputs []contextwindow.Record) ([]contextwindow.Record, int, error) {
+	return r.CallWithOpts(ctx, inputs, contextwindow.CallModelOpts{})
+}
+
+func (r *ResponsesModel) CallWithOpts(ctx context.Context, inputs []contextwindow.Record, opts contextwindow.CallModelOpts) ([]contextwindow.Record, int, error) {
+	req := responsesRequest{
+		Model:  r.model,
+		Input:  responsesInputs(inputs),
+		Stream: r.onDelta != nil && !isQuiet(ctx),
+	}
+
+	if !opts.DisableTools {
+		specs, err := toolSpecs(r.executor)
+		if err != nil {
+			return nil, 0, fmt.Errorf("responses: %w", err)
+		}
+		for _, spec := range specs {
+			req.Tools = append(req.Tools, responsesTool{Type: "function", toolSpec: spec})
+		}
+	}
+
+	var (
+		events []contextwindow.Record
+		tokens int
+	)
+
+	for {
+		resp, err := r.respond(ctx, req)
+		if err != nil {
+			return nil, 0, err
+		}
+		tokens += resp.tokens()
+
+		var calls []responsesOutput
+		for _, o := range resp.Output {
+			if o.Type == "function_call" {
+				calls = append(calls, o)
+			}
+		}
+
+		if len(calls) == 0 {
+			events = append(events, contextwindow.Record{
+				Source:  contextwindow.ModelResp,
+				Content: resp.text(),
+				Live:    true,
+			})
+			return events, tokens, nil
+		}
+
+		for _, fc := range calls {
+			out := runTool(ctx, r.executor, r.middleware, fc.Name, fc.Arguments)
+
+			req.Input = append(req.Input,
+				responsesInput{
+					Type:      "function_call",
+					CallID:    fc.CallID,
+					Name:      fc.Name,
+					Arguments: fc.Arguments,
+				},
+				responsesInput{
+					Type:   "function_call_output",
+					CallID: fc.CallID,
+					Output: &out,
+				})
+
+			call := fmt.Sprintf("%s(%s)", fc.Name, fc.Arguments)
+			events = append(events,
+				contextwindow.Record{
+					Source:  contextwindow.ToolCall,
+					Content: call,
+					Live:    true,
+				},
+				contextwindow.Record{
+					Source:  contextwindow.ToolOutput,
+					Content: out,
+					Live:    true,
+				})
+		}
+	}
+}
+
+// earlier tool calls go back as text, like chatMessages.
+func responsesInputs(inputs []contextwindow.Record) []responsesInput {
+	var items []responsesInput
+
+	for _, rec := range inputs {
+		content := rec.Content
+
+		switch rec.Source {
+		case contextwindow.SystemPrompt:
+			items = append([]responsesInput{{Role: "system", Content: &content}}, items...)
+		case contextwindow.Prompt, contextwindow.ToolOutput:
+			items = append(items, responsesInput{Role: "user", Content: &content})
+		case contextwindow.ModelResp, contextwindow.ToolCall:
+			items = append(items, responsesInput{Role: "assistant", Content: &content})
+		}
+	}
+
+	return items
+}
+
+func (r *ResponsesModel) respond(ctx context.Context, req responsesRequest) (*responsesResponse, error) {
+	headers := map[string]string{"Authorization": "Bearer " + r.apiKey}
+
+	resp, err := postJSON(ctx, r.client, r.baseURL+"/responses", headers, req)
+	if err != nil {
+		return nil, fmt.Errorf("responses: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if isEventStream(resp) {
+		onDelta := r.onDelta
+		if !req.Stream {
+			onDelta = nil
+		}
+		return readResponsesStream(resp.Body, onDelta)
+	}
+
+	var rr responsesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rr); err != nil {
+		return nil, fmt.Errorf("responses: decode response: %w", err)
+	}
+
+	return &rr, nil
+}
+
+type responsesEvent struct {
+	Type     string             `json:"type"`
+	Delta    string             `json:"delta"`
+	Message  string             `json:"message"`
+	Response *responsesResponse `json:"response"`
+}
+
+// the text arrives as deltas, and the whole response, tool calls and
+// usage included, with response.completed at the end.
+func readResponsesStream(r io.Reader, onDelta func(string)) (*responsesResponse, error) {
+	var done *responsesResponse
+
+	err := scanEvents(r, func(data string) error {
+		var ev responsesEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return fmt.Errorf("decode stream: %w", err)
+		}
+
+		switch ev.Type {
+		case "response.output_text.delta":
+			if onDelta != nil && ev.Delta != "" {
+				onDelta(ev.Delta)
+			}
+		case "response.completed":
+			done = ev.Response
+			return errStreamDone
+		case "response.failed", "response.incomplete":
+			return fmt.Errorf("%s", ev.Type)
+		case "error":
+			return fmt.Errorf("%s", ev.Message)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("responses: %w", err)
+	}
+	if done == nil {
+		return nil, fmt.Errorf("responses: stream ended without a response")
+	}
+
+	return done, nil
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/superfly/contextwindow"
+)
+
+func TestResponsesModelToolLoop(t *testing.T) {
+	var requests []responsesRequest
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/responses", r.URL.Path)
+		assert.Equal(t, "Bearer sk-test", r.Header.Get("Authorization"))
+
+		var req responsesRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(requests) == 1 {
+			fmt.Fprint(w, `{"id":"resp_1","output":[{"type":"function_call","call_id":"call_1",
+				"name":"ping","arguments":"{\"host\":\"pg-7\"}"}],"usage":{"total_tokens":10}}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"resp_2","output":[{"type":"message","role":"assistant",
+			"content":[{"type":"output_text","text":"pg-7 is up"}]}],"usage":{"total_tokens":32}}`)
+	}))
+	defer srv.Close()
+
+	model, err := NewResponsesModel(srv.URL+"/v1/", "sk-test", "gpt-5-mini")
+	assert.NoError(t, err)
+
+	tools := &echoTools{}
+	model.SetToolExecutor(tools)
+
+	events, tokens, err := model.Call(context.Background(), []contextwindow.Record{
+		{Source: contextwindow.SystemPrompt, Content: "be brief"},
+		{Source: contextwindow.Prompt, Content: "is pg-7 up?"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 42, tokens)
+
+	assert.Equal(t, []string{`ping {"host":"pg-7"}`}, tools.calls)
+	assert.Len(t, events, 3)
+	assert.Equal(t, contextwindow.ToolCall, events[0].Source)
+	assert.Equal(t, "pong from ping", events[1].Content)
+	assert.Equal(t, "pg-7 is up", events[2].Content)
+
+	assert.Len(t, requests, 2)
+	assert.Equal(t, "gpt-5-mini", requests[0].Model)
+	assert.Equal(t, "system", requests[0].Input[0].Role)
+	assert.Len(t, requests[0].Tools, 1)
+	assert.Equal(t, "function", requests[0].Tools[0].Type)
+	assert.Equal(t, "ping", requests[0].Tools[0].Name)
+
+	input := requests[1].Input
+	assert.Equal(t, "function_call", input[len(input)-2].Type)
+	last := input[len(input)-1]
+	assert.Equal(t, "function_call_output", last.Type)
+	assert.Equal(t, "call_1", last.CallID)
+	assert.Equal(t, "pong from ping", *last.Output)
+}
+
+func TestResponsesModelStreaming(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req responsesRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.True(t, req.Stream)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, piece := range []string{"disk ", "is ", "full"} {
+			fmt.Fprintf(w, "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":%q}\n\n", piece)
+		}
+		fmt.Fprint(w, "event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":"+
+			"{\"id\":\"resp_1\",\"output\":[{\"type\":\"message\",\"content\":"+
+			"[{\"type\":\"output_text\",\"text\":\"disk is full\"}]}],\"usage\":{\"total_tokens\":42}}}\n\n")
+	}))
+	defer srv.Close()
+
+	model, err := NewResponsesModel(srv.URL, "sk-test", "gpt-5-mini")
+	assert.NoError(t, err)
+
+	ag, err := NewAgent(testDB(t), model, "hosted")
+	assert.NoError(t, err)
+
+	var deltas []string
+	ag.OnEvent = func(msg Message) {
+		if d, ok := msg.(ModelDeltaMsg); ok {
+			deltas = append(deltas, d.Delta)
+		}
+	}
+
+	response, err := ag.RunPrompt("why is pg-7 slow?")
+	assert.NoError(t, err)
+	assert.Equal(t, "disk is full", response)
+	assert.Equal(t, "disk is full", strings.Join(deltas, ""))
+
+	usage, err := ag.GetContextWindow().TokenUsage()
+	assert.NoError(t, err)
+	assert.Equal(t, 42, usage.Total)
+}
+
+func TestResponsesModelStreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"type\":\"error\",\"message\":\"rate limited\"}\n\n")
+	}))
+	defer srv.Close()
+
+	model, err := NewResponsesModel(srv.URL, "sk-test", "gpt-5-mini")
+	assert.NoError(t, err)
+	model.SetOnDelta(func(string) {})
+
+	_, _, err = model.Call(context.Background(), []contextwindow.Record{
+		{Source: contextwindow.Prompt, Content: "hi"},
+	})
+	assert.ErrorContains(t, err, "rate limited")
+}
@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+type SearchHit struct {
+	Context  string
+	RecordID int64
+	Index    int
+	Snippet  string
+}
+
+// every word of the query has to appear; words are quoted so
+// punctuation like "pg-7" isn't taken as FTS syntax.
+func ftsQuery(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// Index counts every record in the context, live or dead, like
+// Agent.Records; records with the same ts are in insertion order.
+func SearchRecords(db *sql.DB, query string, limit int) ([]SearchHit, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, fmt.Errorf("search: empty query")
+	}
+
+	rows, err := db.Query(
+		`WITH numbered AS (
+		   SELECT id, ROW_NUMBER() OVER (
+		     PARTITION BY context_id ORDER BY ts, id) - 1 AS idx
+		   FROM records
+		 )
+		 SELECT c.name, r.id, n.idx,
+		   snippet(records_fts, 0, '[', ']', '…', 12)
+		 FROM records_fts
+		 JOIN records r ON r.id = records_fts.rowid
+		 JOIN numbered n ON n.id = r.id
+		 JOIN contexts c ON c.id = r.context_id
+		 WHERE records_fts MATCH ?
+		 ORDER BY rank
+		 LIMIT ?`,
+		match, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+	defer rows.Close()
+
+	var ret []SearchHit
+	for rows.Next() {
+		var h SearchHit
+		if err := rows.Scan(&h.Context, &h.RecordID, &h.Index, &h.Snippet); err != nil {
+			return nil, fmt.Errorf("scan search hit: %w", err)
+		}
+		h.Snippet = strings.Join(strings.Fields(h.Snippet), " ")
+		ret = append(ret, h)
+	}
+
+	return ret, rows.Err()
+}
+
+func (a *Agent) Search(query string, limit int) ([]SearchHit, error) {
+	return SearchRecords(a.db, query, limit)
+}
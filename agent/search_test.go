@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/superfly/contextwindow"
+)
+
+func TestSearchRecords(t *testing.T) {
+	db := testDB(t)
+
+	for _, c := range []struct {
+		name    string
+		records []string
+	}{
+		{"zk-outage", []string{"zookeeper is down", "leader election stuck on zk-3"}},
+		{"pg-slow", []string{"pg-7 is slow", "the zookeeper client is unrelated"}},
+	} {
+		ctx, err := contextwindow.CreateContext(db, c.name)
+		assert.NoError(t, err)
+		for _, content := range c.records {
+			_, err := contextwindow.InsertRecord(db, ctx.ID,
+				contextwindow.Prompt, content, true)
+			assert.NoError(t, err)
+		}
+	}
+
+	hits, err := SearchRecords(db, "leader election", 10)
+	assert.NoError(t, err)
+	assert.Len(t, hits, 1)
+	assert.Equal(t, "zk-outage", hits[0].Context)
+	assert.Equal(t, 1, hits[0].Index)
+	assert.Contains(t, hits[0].Snippet, "[leader] [election]")
+
+	hits, err = SearchRecords(db, "zookeeper", 10)
+	assert.NoError(t, err)
+	assert.Len(t, hits, 2)
+
+	hits, err = SearchRecords(db, "pg-7", 10)
+	assert.NoError(t, err)
+	assert.Len(t, hits, 1)
+	assert.Equal(t, "pg-slow", hits[0].Context)
+
+	_, err = db.Exec(`DELETE FROM records WHERE content = 'pg-7 is slow'`)
+	assert.NoError(t, err)
+	hits, err = SearchRecords(db, "pg-7", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, hits)
+}
+
+func TestSearchIndexWithTiedTimestamps(t *testing.T) {
+	db := testDB(t)
+
+	ctx, err := contextwindow.CreateContext(db, "tied")
+	assert.NoError(t, err)
+	for _, content := range []string{"alpha", "bravo", "charlie", "delta"} {
+		_, err := contextwindow.InsertRecord(db, ctx.ID,
+			contextwindow.Prompt, content, true)
+		assert.NoError(t, err)
+	}
+
+	_, err = db.Exec(`UPDATE records SET ts = (SELECT MIN(ts) FROM records)`)
+	assert.NoError(t, err)
+
+	for i, word := range []string{"alpha", "bravo", "charlie", "delta"} {
+		hits, err := SearchRecords(db, word, 10)
+		assert.NoError(t, err)
+		assert.Len(t, hits, 1)
+		assert.Equal(t, i, hits[0].Index, word)
+	}
+}
+
+func TestSearchIndexRebuild(t *testing.T) {
+	db, err := contextwindow.NewContextDB(":memory:")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	ctx, err := contextwindow.CreateContext(db, "old")
+	assert.NoError(t, err)
+	_, err = contextwindow.InsertRecord(db, ctx.ID,
+		contextwindow.Prompt, "written before the index existed", true)
+	assert.NoError(t, err)
+
+	assert.NoError(t, InitializeSchema(db))
+	assert.NoError(t, InitializeSchema(db))
+
+	hits, err := SearchRecords(db, "index existed", 10)
+	assert.NoError(t, err)
+	assert.Len(t, hits, 1)
+}
@@ -0,0 +1,231 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/superfly/contextwindow"
+)
+
+// what a conversation was set up with, so resuming it (or switching
+// to it) puts things back the way they were. Model is "provider/name";
+// an empty BaseURL is the provider's usual endpoint.
+type ContextSettings struct {
+	SystemPrompt string
+	ToolsPath    string
+	Model        string
+	BaseURL      string
+	MaxTokens    int
+}
+
+// opens "name" from "provider" at baseURL; main supplies it, since the
+// agent doesn't know how to reach any particular provider.
+type ModelOpener func(provider, name, baseURL string) (contextwindow.Model, string, error)
+
+// describes how s differs from saved, for warnings.
+func (s ContextSettings) Changes(saved ContextSettings) []string {
+	var changes []string
+
+	if s.SystemPrompt != saved.SystemPrompt {
+		changes = append(changes, "system prompt")
+	}
+	if s.ToolsPath != saved.ToolsPath {
+		changes = append(changes, fmt.Sprintf("tools %s (was %s)", s.ToolsPath, saved.ToolsPath))
+	}
+	if s.Model != saved.Model {
+		changes = append(changes, fmt.Sprintf("model %s (was %s)", s.Model, saved.Model))
+	}
+	if s.BaseURL != saved.BaseURL {
+		changes = append(changes, fmt.Sprintf("base-url %s (was %s)",
+			orDefault(s.BaseURL), orDefault(saved.BaseURL)))
+	}
+	if s.MaxTokens != saved.MaxTokens {
+		changes = append(changes, fmt.Sprintf("maxtokens %d (was %d)", s.MaxTokens, saved.MaxTokens))
+	}
+
+	return changes
+}
+
+func orDefault(url string) string {
+	if url == "" {
+		return "default"
+	}
+	return url
+}
+
+func LoadContextSettings(db *sql.DB, name string) (ContextSettings, bool, error) {
+	var s ContextSettings
+
+	err := db.QueryRow(
+		`SELECT system_prompt, tools_path, model, base_url, max_tokens
+		 FROM context_settings WHERE context = ?`, name,
+	).Scan(&s.SystemPrompt, &s.ToolsPath, &s.Model, &s.BaseURL, &s.MaxTokens)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, false, nil
+	}
+	if err != nil {
+		return s, false, fmt.Errorf("settings for %s: %w", name, err)
+	}
+
+	return s, true, nil
+}
+
+func saveContextSettings(db *sql.DB, name string, s ContextSettings) error {
+	_, err := db.Exec(
+		`INSERT OR REPLACE INTO context_settings
+		 (context, system_prompt, tools_path, model, base_url, max_tokens, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		name, s.SystemPrompt, s.ToolsPath, s.Model, s.BaseURL, s.MaxTokens, time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("save settings for %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// the settings in effect right now.
+func (a *Agent) Settings() ContextSettings {
+	a.settingsLock.Lock()
+	s := a.settings
+	a.settingsLock.Unlock()
+
+	s.Model = a.ModelName()
+	return s
+}
+
+// records the settings in effect as the current conversation's.
+func (a *Agent) SaveSettings() error {
+	return saveContextSettings(a.db, a.ContextName(), a.Settings())
+}
+
+// puts the current conversation's saved settings into effect. a
+// conversation with none yet gets the ones in effect now. whatever
+// can't be restored (a model that won't open, a tools file that's
+// gone) stays as it was, and the rest is restored anyway. called with
+// a.lock held, so no turn sees the settings half restored.
+func (a *Agent) restoreSettings() error {
+	saved, ok, err := LoadContextSettings(a.db, a.ContextName())
+	if err != nil {
+		return err
+	}
+
+	current := a.Settings()
+
+	if !ok {
+		if prompt := current.SystemPrompt; prompt != "" {
+			if err := a.context.SetSystemPrompt(prompt); err != nil {
+				return err
+			}
+		}
+		return a.SaveSettings()
+	}
+
+	var errs []error
+
+	moved := saved.Model != current.Model || saved.BaseURL != current.BaseURL
+	if saved.Model != "" && moved && a.OpenModel != nil {
+		provider, name, _ := strings.Cut(saved.Model, "/")
+		m, used, err := a.OpenModel(provider, name, saved.BaseURL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("restore model %s: %w", saved.Model, err))
+		} else {
+			a.model.set(used, m)
+			a.SetBaseURL(saved.BaseURL)
+		}
+	}
+
+	if saved.ToolsPath != "" && saved.ToolsPath != current.ToolsPath {
+		if err := a.LoadTools(saved.ToolsPath); err != nil {
+			errs = append(errs, fmt.Errorf("restore tools: %w", err))
+		}
+	}
+
+	if saved.MaxTokens > 0 {
+		a.SetMaxTokens(saved.MaxTokens)
+	}
+
+	// the prompt itself is already a record in the conversation.
+	a.settingsLock.Lock()
+	a.settings.SystemPrompt = saved.SystemPrompt
+	a.settingsLock.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// the context window has one set of tools for every conversation, so
+// the tools loaded from other files stay registered; this hides them
+// from the model and refuses to run them.
+type toolFilter struct {
+	lock    sync.Mutex
+	exec    contextwindow.ToolExecutor
+	allowed map[string]bool
+}
+
+func (f *toolFilter) setExecutor(e contextwindow.ToolExecutor) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.exec = e
+}
+
+func (f *toolFilter) executor() contextwindow.ToolExecutor {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.exec
+}
+
+// nil allows everything.
+func (f *toolFilter) restrict(names []string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if names == nil {
+		f.allowed = nil
+		return
+	}
+
+	f.allowed = map[string]bool{}
+	for _, n := range names {
+		f.allowed[n] = true
+	}
+}
+
+func (f *toolFilter) allows(name string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.allowed == nil || f.allowed[name]
+}
+
+func (f *toolFilter) ExecuteTool(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	exec := f.executor()
+	if exec == nil || !f.allows(name) {
+		return "", fmt.Errorf("tool '%s' not available in this conversation", name)
+	}
+
+	return exec.ExecuteTool(ctx, name, args)
+}
+
+func (f *toolFilter) GetRegisteredTools() []contextwindow.ToolDefinition {
+	exec := f.executor()
+	if exec == nil {
+		return nil
+	}
+
+	var tools []contextwindow.ToolDefinition
+	for _, t := range exec.GetRegisteredTools() {
+		if f.allows(t.Name) {
+			tools = append(tools, t)
+		}
+	}
+
+	return tools
+}
@@ -0,0 +1,273 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/superfly/contextwindow"
+)
+
+func toolNames(ag *Agent) []string {
+	var names []string
+	for _, t := range ag.model.tools.GetRegisteredTools() {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+func TestSettingsFollowConversation(t *testing.T) {
+	db := testDB(t)
+	dir := t.TempDir()
+
+	pingPath := writeToolConfig(t, dir, "ping.toml", `
+[[tool]]
+name = "ping"
+description = "ping a host"
+command = "echo pong {host}"
+`)
+	tracePath := writeToolConfig(t, dir, "trace.toml", `
+[[tool]]
+name = "trace"
+description = "trace a host"
+command = "echo trace {host}"
+`)
+
+	ag, err := NewAgent(db, NewFakeModel(nil), "a")
+	assert.NoError(t, err)
+
+	var opened []string
+	ag.OpenModel = func(provider, name, baseURL string) (contextwindow.Model, string, error) {
+		opened = append(opened, provider+"/"+name+"@"+baseURL)
+		return NewFakeModel(nil), provider + "/" + name, nil
+	}
+
+	ag.SetModelName("fake/one")
+	ag.SetSystemPrompt("you are a")
+	ag.SetMaxTokens(1000)
+	assert.NoError(t, ag.LoadTools(pingPath))
+	assert.NoError(t, ag.SaveSettings())
+
+	a := ContextSettings{
+		SystemPrompt: "you are a",
+		ToolsPath:    pingPath,
+		Model:        "fake/one",
+		MaxTokens:    1000,
+	}
+
+	// a new conversation starts with what's in effect.
+	assert.NoError(t, ag.SwitchContext("b"))
+	saved, ok, err := LoadContextSettings(db, "b")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, a, saved)
+
+	ag.SetSystemPrompt("you are b")
+	ag.SetMaxTokens(2000)
+	assert.NoError(t, ag.LoadTools(tracePath))
+	ag.SetBaseURL("http://localhost:11434/v1")
+	ag.SetModel("fake/two", NewFakeModel(nil))
+
+	b := ContextSettings{
+		SystemPrompt: "you are b",
+		ToolsPath:    tracePath,
+		Model:        "fake/two",
+		BaseURL:      "http://localhost:11434/v1",
+		MaxTokens:    2000,
+	}
+
+	saved, _, err = LoadContextSettings(db, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, b, saved)
+	assert.Equal(t, []string{"trace"}, toolNames(ag))
+
+	_, err = ag.model.tools.ExecuteTool(context.Background(), "ping", []byte(`{"host":"x"}`))
+	assert.Error(t, err)
+
+	assert.NoError(t, ag.SwitchContext("a"))
+	assert.Equal(t, a, ag.Settings())
+	assert.Equal(t, []string{"fake/one@"}, opened)
+	assert.Equal(t, []string{"ping"}, toolNames(ag))
+	assert.Equal(t, 1000, ag.GetContextWindow().MaxTokens())
+
+	assert.NoError(t, ag.SwitchContext("b"))
+	assert.Equal(t, b, ag.Settings())
+	assert.Equal(t, []string{"fake/one@", "fake/two@http://localhost:11434/v1"}, opened)
+	assert.Equal(t, []string{"trace"}, toolNames(ag))
+}
+
+func TestSettingsRestoreWhenModelFails(t *testing.T) {
+	db := testDB(t)
+	dir := t.TempDir()
+
+	pingPath := writeToolConfig(t, dir, "ping.toml", `
+[[tool]]
+name = "ping"
+description = "ping a host"
+command = "echo pong {host}"
+`)
+
+	ag, err := NewAgent(db, NewFakeModel(nil), "a")
+	assert.NoError(t, err)
+	ag.OpenModel = func(provider, name, baseURL string) (contextwindow.Model, string, error) {
+		return nil, "", fmt.Errorf("no API key for %s", provider)
+	}
+
+	ag.SetModelName("claude/sonnet")
+	ag.SetMaxTokens(1000)
+	assert.NoError(t, ag.LoadTools(pingPath))
+	assert.NoError(t, ag.SaveSettings())
+
+	assert.NoError(t, ag.SwitchContext("b"))
+	ag.SetModel("fake/two", NewFakeModel(nil))
+	ag.SetMaxTokens(2000)
+	assert.NoError(t, ag.LoadTools(writeToolConfig(t, dir, "empty.toml", "")))
+
+	err = ag.SwitchContext("a")
+	assert.ErrorContains(t, err, "restore model claude/sonnet: no API key for claude")
+
+	// the model stays, but the rest is a's.
+	assert.Equal(t, "fake/two", ag.ModelName())
+	assert.Equal(t, 1000, ag.GetContextWindow().MaxTokens())
+	assert.Equal(t, []string{"ping"}, toolNames(ag))
+
+	saved, _, err := LoadContextSettings(db, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "claude/sonnet", saved.Model)
+}
+
+func TestSettingsFollowRenameForkDelete(t *testing.T) {
+	db := testDB(t)
+
+	ag, err := NewAgent(db, NewFakeModel(nil), "a")
+	assert.NoError(t, err)
+	ag.SetModelName("fake/one")
+	ag.SetBaseURL("http://localhost:8080/v1")
+	ag.SetSystemPrompt("you are a")
+	ag.SetMaxTokens(1000)
+	assert.NoError(t, ag.SaveSettings())
+
+	assert.NoError(t, ag.RenameContext("a", "c"))
+	_, ok, err := LoadContextSettings(db, "a")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	c, ok, err := LoadContextSettings(db, "c")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "you are a", c.SystemPrompt)
+	assert.Equal(t, "http://localhost:8080/v1", c.BaseURL)
+
+	_, err = NewAgentForked(db, NewFakeModel(nil), "d", "c")
+	assert.NoError(t, err)
+	d, ok, err := LoadContextSettings(db, "d")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, c, d)
+
+	assert.NoError(t, ag.DeleteContext("d"))
+	_, ok, err = LoadContextSettings(db, "d")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestSettingsChanges(t *testing.T) {
+	saved := ContextSettings{
+		SystemPrompt: "old",
+		ToolsPath:    "a.toml",
+		Model:        "openai/gpt-5",
+		MaxTokens:    1000,
+	}
+
+	assert.Empty(t, saved.Changes(saved))
+
+	now := saved
+	now.SystemPrompt = "new"
+	now.Model = "claude/claude-sonnet-4-5"
+	now.BaseURL = "http://localhost:4000"
+	assert.Equal(t, []string{
+		"system prompt",
+		"model claude/claude-sonnet-4-5 (was openai/gpt-5)",
+		"base-url http://localhost:4000 (was default)",
+	}, now.Changes(saved))
+}
+
+func TestSettingsFromBeforeBaseURL(t *testing.T) {
+	db, err := contextwindow.NewContextDB(":memory:")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	_, err = db.Exec(`
+CREATE TABLE context_settings (
+    context       TEXT PRIMARY KEY,
+    system_prompt TEXT NOT NULL,
+    tools_path    TEXT NOT NULL,
+    model         TEXT NOT NULL,
+    max_tokens    INTEGER NOT NULL,
+    updated_at    DATETIME NOT NULL
+);
+INSERT INTO context_settings VALUES ('a', 'you are a', '', 'openai/gpt-5', 1000, '2026-01-01');
+`)
+	assert.NoError(t, err)
+
+	assert.NoError(t, InitializeSchema(db))
+	assert.NoError(t, InitializeSchema(db))
+
+	saved, ok, err := LoadContextSettings(db, "a")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, ContextSettings{
+		SystemPrompt: "you are a",
+		Model:        "openai/gpt-5",
+		MaxTokens:    1000,
+	}, saved)
+}
+
+// answers once release is closed.
+type blockingModel struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (m *blockingModel) Call(ctx context.Context, inputs []contextwindow.Record) ([]contextwindow.Record, int, error) {
+	close(m.started)
+	<-m.release
+	return []contextwindow.Record{{Source: contextwindow.ModelResp, Content: "done", Live: true}}, 0, nil
+}
+
+func TestSwitchWaitsForTurn(t *testing.T) {
+	model := &blockingModel{started: make(chan struct{}), release: make(chan struct{})}
+
+	ag, err := NewAgent(testDB(t), model, "a")
+	assert.NoError(t, err)
+	ag.SetMaxTokens(1000)
+	assert.NoError(t, ag.SaveSettings())
+
+	turn := make(chan error)
+	go func() {
+		_, err := ag.RunPrompt("check pg-7")
+		turn <- err
+	}()
+	<-model.started
+
+	switched := make(chan error)
+	go func() {
+		switched <- ag.SwitchContext("b")
+	}()
+
+	// the UI still reads settings while the turn runs.
+	assert.Equal(t, 1000, ag.Settings().MaxTokens)
+
+	select {
+	case <-switched:
+		t.Fatal("switched in the middle of a turn")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(model.release)
+	assert.NoError(t, <-turn)
+	assert.NoError(t, <-switched)
+	assert.Equal(t, "b", ag.ContextName())
+}
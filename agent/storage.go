@@ -0,0 +1,198 @@
+package agent
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func InitializeSchema(db *sql.DB) error {
+	const tables = `
+CREATE TABLE IF NOT EXISTS artifacts (
+    id         TEXT NOT NULL,
+    context    TEXT NOT NULL,
+    tool       TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    content    TEXT NOT NULL,
+    PRIMARY KEY (context, id)
+);
+
+CREATE TABLE IF NOT EXISTS todos (
+    id      INTEGER PRIMARY KEY AUTOINCREMENT,
+    context TEXT NOT NULL,
+    entry   TEXT NOT NULL,
+    done    BOOLEAN NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_todos_context ON todos(context);
+
+CREATE TABLE IF NOT EXISTS context_models (
+    context    TEXT PRIMARY KEY,
+    model      TEXT NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS response_models (
+    record_id INTEGER PRIMARY KEY,
+    model     TEXT NOT NULL
+);
+
+CREATE TRIGGER IF NOT EXISTS response_models_delete AFTER DELETE ON records BEGIN
+    DELETE FROM response_models WHERE record_id = old.id;
+END;
+
+CREATE TABLE IF NOT EXISTS context_settings (
+    context       TEXT PRIMARY KEY,
+    system_prompt TEXT NOT NULL,
+    tools_path    TEXT NOT NULL,
+    model         TEXT NOT NULL,
+    base_url      TEXT NOT NULL DEFAULT '',
+    max_tokens    INTEGER NOT NULL,
+    updated_at    DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS notes (
+    scope      TEXT NOT NULL,
+    key        TEXT NOT NULL,
+    value      TEXT NOT NULL,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (scope, key)
+);
+`
+
+	if _, err := db.Exec(tables); err != nil {
+		return fmt.Errorf("create agent tables: %w", err)
+	}
+
+	if err := addColumn(db, "context_settings", "base_url", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	if err := rekeyArtifacts(db); err != nil {
+		return err
+	}
+
+	return initializeSearch(db)
+}
+
+// artifacts used to be keyed by id alone, so a fork couldn't have its
+// own copy of an artifact under the handle its records refer to.
+func rekeyArtifacts(db *sql.DB) error {
+	var n int
+
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM pragma_table_info('artifacts') WHERE pk > 0`,
+	).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("check artifacts key: %w", err)
+	}
+	if n != 1 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("rekey artifacts: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, q := range []string{
+		`ALTER TABLE artifacts RENAME TO artifacts_old`,
+		`CREATE TABLE artifacts (
+		    id         TEXT NOT NULL,
+		    context    TEXT NOT NULL,
+		    tool       TEXT NOT NULL,
+		    created_at DATETIME NOT NULL,
+		    content    TEXT NOT NULL,
+		    PRIMARY KEY (context, id)
+		)`,
+		`INSERT INTO artifacts (id, context, tool, created_at, content)
+		 SELECT id, context, tool, created_at, content FROM artifacts_old`,
+		`DROP TABLE artifacts_old`,
+	} {
+		if _, err := tx.Exec(q); err != nil {
+			return fmt.Errorf("rekey artifacts: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("rekey artifacts: %w", err)
+	}
+
+	return nil
+}
+
+// for tables that were created before column was.
+func addColumn(db *sql.DB, table, column, decl string) error {
+	var n int
+
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column,
+	).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("check %s.%s: %w", table, column, err)
+	}
+	if n > 0 {
+		return nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, decl))
+	if err != nil {
+		return fmt.Errorf("add %s.%s: %w", table, column, err)
+	}
+
+	return nil
+}
+
+// records_fts indexes record content for /search. it's an external
+// content table over records, kept current by triggers; a database
+// that predates it gets rebuilt once, when the index is created.
+func initializeSearch(db *sql.DB) error {
+	const search = `
+CREATE VIRTUAL TABLE records_fts USING fts5(
+    content,
+    content='records',
+    content_rowid='id'
+);
+
+CREATE TRIGGER records_fts_insert AFTER INSERT ON records BEGIN
+    INSERT INTO records_fts(rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER records_fts_delete AFTER DELETE ON records BEGIN
+    INSERT INTO records_fts(records_fts, rowid, content)
+    VALUES ('delete', old.id, old.content);
+END;
+
+CREATE TRIGGER records_fts_update AFTER UPDATE OF content ON records BEGIN
+    INSERT INTO records_fts(records_fts, rowid, content)
+    VALUES ('delete', old.id, old.content);
+    INSERT INTO records_fts(rowid, content) VALUES (new.id, new.content);
+END;
+
+INSERT INTO records_fts(records_fts) VALUES ('rebuild');
+`
+
+	var n int
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM sqlite_master WHERE name = 'records_fts'`,
+	).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("check search index: %w", err)
+	}
+
+	if n > 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("create search index: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(search); err != nil {
+		return fmt.Errorf("create search index: %w", err)
+	}
+
+	return tx.Commit()
+}
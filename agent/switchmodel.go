@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/superfly/contextwindow"
+)
+
+// the context window binds its model at construction, so the agent
+// hands it this proxy instead and swaps what's behind it. whatever
+// the context window installed on the old model (tool executor,
+// middleware) and our delta hook get installed on the new one.
+type switchModel struct {
+	lock       sync.Mutex
+	name       string
+	inner      contextwindow.Model
+	tools      toolFilter
+	middleware []contextwindow.Middleware
+	onDelta    func(string)
+}
+
+func (s *switchModel) set(name string, m contextwindow.Model) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.name = name
+	s.inner = m
+
+	if tc, ok := m.(contextwindow.ToolCapable); ok && s.tools.executor() != nil {
+		tc.SetToolExecutor(&s.tools)
+	}
+
+	if mc, ok := m.(contextwindow.MiddlewareCapable); ok && s.middleware != nil {
+		mc.SetMiddleware(s.middleware)
+	}
+
+	if sm, ok := m.(StreamingModel); ok && s.onDelta != nil {
+		sm.SetOnDelta(s.onDelta)
+	}
+}
+
+func (s *switchModel) setName(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.name = name
+}
+
+func (s *switchModel) Name() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.name
+}
+
+func (s *switchModel) current() contextwindow.Model {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.inner
+}
+
+func (s *switchModel) SetToolExecutor(e contextwindow.ToolExecutor) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.tools.setExecutor(e)
+	if tc, ok := s.inner.(contextwindow.ToolCapable); ok {
+		tc.SetToolExecutor(&s.tools)
+	}
+}
+
+func (s *switchModel) SetMiddleware(mw []contextwindow.Middleware) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.middleware = mw
+	if mc, ok := s.inner.(contextwindow.MiddlewareCapable); ok {
+		mc.SetMiddleware(mw)
+	}
+}
+
+func (s *switchModel) SetOnDelta(fn func(string)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.onDelta = fn
+	if sm, ok := s.inner.(StreamingModel); ok {
+		sm.SetOnDelta(fn)
+	}
+}
+
+func (s *switchModel) Call(ctx context.Context, inputs []contextwindow.Record) ([]contextwindow.Record, int, error) {
+	return s.current().Call(ctx, inputs)
+}
+
+// contextwindow.CallOptsCapable also wants the threading variant,
+// which models that can't thread (ours) have no use for.
+type optsModel interface {
+	CallWithOpts(ctx context.Context, inputs []contextwindow.Record, opts contextwindow.CallModelOpts) ([]contextwindow.Record, int, error)
+}
+
+func (s *switchModel) CallWithOpts(ctx context.Context, inputs []contextwindow.Record, opts contextwindow.CallModelOpts) ([]contextwindow.Record, int, error) {
+	m := s.current()
+	if om, ok := m.(optsModel); ok {
+		return om.CallWithOpts(ctx, inputs, opts)
+	}
+	return m.Call(ctx, inputs)
+}
+
+func (s *switchModel) CallWithThreading(ctx context.Context, threading bool, lastResponseID *string, inputs []contextwindow.Record) ([]contextwindow.Record, *string, int, error) {
+	m := s.current()
+	tm, ok := m.(contextwindow.ServerSideThreadingCapable)
+	if !ok {
+		events, tokens, err := m.Call(ctx, inputs)
+		return events, nil, tokens, err
+	}
+	return tm.CallWithThreading(ctx, threading, threadFrom(lastResponseID, inputs), inputs)
+}
+
+func (s *switchModel) CallWithThreadingAndOpts(ctx context.Context, threading bool, lastResponseID *string, inputs []contextwindow.Record, opts contextwindow.CallModelOpts) ([]contextwindow.Record, *string, int, error) {
+	m := s.current()
+	if _, ok := m.(contextwindow.ServerSideThreadingCapable); !ok {
+		events, tokens, err := s.CallWithOpts(ctx, inputs, opts)
+		return events, nil, tokens, err
+	}
+	om, ok := m.(contextwindow.CallOptsCapable)
+	if !ok {
+		return s.CallWithThreading(ctx, threading, lastResponseID, inputs)
+	}
+	return om.CallWithThreadingAndOpts(ctx, threading, threadFrom(lastResponseID, inputs), inputs, opts)
+}
+
+// the context's last response id can be left over from before a
+// switch, when some other model answered in between; a server-side
+// thread is only safe to continue if it ends with the latest response.
+func threadFrom(lastResponseID *string, inputs []contextwindow.Record) *string {
+	if lastResponseID == nil {
+		return nil
+	}
+
+	for i := len(inputs) - 1; i >= 0; i-- {
+		if inputs[i].Source != contextwindow.ModelResp {
+			continue
+		}
+		if id := inputs[i].ResponseID; id != nil && *id == *lastResponseID {
+			return lastResponseID
+		}
+		return nil
+	}
+
+	return nil
+}
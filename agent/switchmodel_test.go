@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/superfly/contextwindow"
+)
+
+func TestSetModel(t *testing.T) {
+	db := testDB(t)
+	cheap := &summaryModel{}
+	smart := &summaryModel{}
+
+	ag, err := NewAgent(db, cheap, "escalate")
+	assert.NoError(t, err)
+	ag.SetModelName("test/cheap")
+
+	_, err = ag.RunPrompt("why is pg-7 slow?")
+	assert.NoError(t, err)
+	assert.Len(t, cheap.inputs, 1)
+
+	ag.SetModel("test/smart", smart)
+	assert.Equal(t, "test/smart", ag.ModelName())
+
+	_, err = ag.RunPrompt("look harder")
+	assert.NoError(t, err)
+	assert.Len(t, cheap.inputs, 1)
+	assert.Len(t, smart.inputs, 3)
+	assert.Equal(t, "why is pg-7 slow?", smart.inputs[0].Content)
+
+	models, err := ag.ResponseModels()
+	assert.NoError(t, err)
+
+	live, err := ag.GetContextWindow().LiveRecords()
+	assert.NoError(t, err)
+	assert.Len(t, live, 4)
+	assert.Equal(t, "test/cheap", models[live[1].ID])
+	assert.Equal(t, "test/smart", models[live[3].ID])
+	assert.Len(t, models, 2)
+
+	assert.NoError(t, ag.DeleteRecords([]int64{live[1].ID}))
+	models, err = ag.ResponseModels()
+	assert.NoError(t, err)
+	assert.Len(t, models, 1)
+}
+
+func TestThreadFrom(t *testing.T) {
+	id := func(s string) *string { return &s }
+
+	inputs := []contextwindow.Record{
+		{Source: contextwindow.Prompt, Content: "hi"},
+		{Source: contextwindow.ModelResp, Content: "hello", ResponseID: id("resp_1")},
+		{Source: contextwindow.Prompt, Content: "again"},
+	}
+
+	assert.Equal(t, "resp_1", *threadFrom(id("resp_1"), inputs))
+	assert.Nil(t, threadFrom(nil, inputs))
+	assert.Nil(t, threadFrom(id("resp_0"), inputs))
+
+	// another model answered after resp_1, without a response id
+	inputs = append(inputs, contextwindow.Record{
+		Source: contextwindow.ModelResp, Content: "from claude",
+	})
+	assert.Nil(t, threadFrom(id("resp_1"), inputs))
+}
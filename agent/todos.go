@@ -0,0 +1,221 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/superfly/contextwindow"
+)
+
+type TodoEntry struct {
+	ID    int64
+	Entry string
+	Done  bool
+}
+
+type TodoStore struct {
+	db *sql.DB
+}
+
+func NewTodoStore(db *sql.DB) *TodoStore {
+	return &TodoStore{db: db}
+}
+
+func (s *TodoStore) List(contextName string) ([]TodoEntry, error) {
+	rows, err := s.db.Query(
+		`SELECT id, entry, done FROM todos WHERE context = ? ORDER BY id ASC`,
+		contextName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list todos: %w", err)
+	}
+	defer rows.Close()
+
+	var ret []TodoEntry
+	for rows.Next() {
+		var e TodoEntry
+		if err := rows.Scan(&e.ID, &e.Entry, &e.Done); err != nil {
+			return nil, fmt.Errorf("scan todo: %w", err)
+		}
+		ret = append(ret, e)
+	}
+
+	return ret, rows.Err()
+}
+
+func (s *TodoStore) Add(contextName, entry string) error {
+	_, err := s.db.Exec(
+		`INSERT INTO todos (context, entry) VALUES (?, ?)`,
+		contextName, entry,
+	)
+	if err != nil {
+		return fmt.Errorf("add todo: %w", err)
+	}
+
+	return nil
+}
+
+// entries are addressed by their 1-based position in List, which is
+// what the model and the user see.
+func (s *TodoStore) nth(contextName string, num int) (TodoEntry, error) {
+	entries, err := s.List(contextName)
+	if err != nil {
+		return TodoEntry{}, err
+	}
+
+	if num < 1 || num > len(entries) {
+		return TodoEntry{}, fmt.Errorf("no entry %d (have %d)", num, len(entries))
+	}
+
+	return entries[num-1], nil
+}
+
+func (s *TodoStore) Delete(contextName string, num int) error {
+	e, err := s.nth(contextName, num)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.Exec(`DELETE FROM todos WHERE id = ?`, e.ID); err != nil {
+		return fmt.Errorf("delete todo: %w", err)
+	}
+
+	return nil
+}
+
+func (s *TodoStore) SetDone(contextName string, num int, done bool) error {
+	e, err := s.nth(contextName, num)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.Exec(`UPDATE todos SET done = ? WHERE id = ?`, done, e.ID); err != nil {
+		return fmt.Errorf("update todo: %w", err)
+	}
+
+	return nil
+}
+
+func (s *TodoStore) Copy(from, to string) error {
+	_, err := s.db.Exec(
+		`INSERT INTO todos (context, entry, done)
+		 SELECT ?, entry, done FROM todos WHERE context = ? ORDER BY id ASC`,
+		to, from,
+	)
+	if err != nil {
+		return fmt.Errorf("copy todos: %w", err)
+	}
+
+	return nil
+}
+
+func FormatTodos(entries []TodoEntry) string {
+	buf := &strings.Builder{}
+
+	for i, e := range entries {
+		mark := " "
+		if e.Done {
+			mark = "x"
+		}
+		fmt.Fprintf(buf, "%d. [%s] %s\n", i+1, mark, e.Entry)
+	}
+
+	return buf.String()
+}
+
+type Todo struct {
+	store *TodoStore
+	cw    *contextwindow.ContextWindow
+}
+
+func NewTodo(store *TodoStore) *Todo {
+	return &Todo{store: store}
+}
+
+func (t *Todo) ToolDescription() string {
+	return `
+name = "todo"
+description = """
+Manage a list of todo steps; good for multistep processes, internal planning, scratch memory.
+The list belongs to this conversation and survives restarts.
+
+You MUST call this tool with an "action".
+
+tool({"action":"add", "entry":"a cool new todo list entry")
+
+"add" adds elements to the list.
+"list" gives a numbered list of the current todo elements; finished ones are marked [x].
+"delete" deletes a numbered entry from the list.
+"done" marks a numbered entry finished; "undone" reopens it.
+"""
+
+[parameters]
+action = { type = "string", description = "add, list, delete, done, or undone", required = true }
+entry = { type = "string", description = "A blob of text to add to the todo list", required = false }
+number = { type = "number", description = "The number of an entry to delete, finish, or reopen", required = false }
+`
+}
+
+func (t *Todo) Init(cw *contextwindow.ContextWindow) error {
+	t.cw = cw
+	return nil
+}
+
+func (t *Todo) Run(ctx context.Context, rawargs json.RawMessage) (string, error) {
+	slog.Info("todo run", "args", string(rawargs))
+
+	args := map[string]any{}
+	if err := json.Unmarshal(rawargs, &args); err != nil {
+		return "", err
+	}
+
+	action, ok := mapGet[string](args, "action")
+	if !ok {
+		return "", fmt.Errorf("no valid action")
+	}
+
+	contextName := t.cw.GetCurrentContext()
+
+	switch action {
+	case "add":
+		entry, ok := mapGet[string](args, "entry")
+		if !ok {
+			return "", fmt.Errorf("no entry")
+		}
+		if err := t.store.Add(contextName, entry); err != nil {
+			return "", err
+		}
+		return "added\n", nil
+
+	case "list":
+		entries, err := t.store.List(contextName)
+		if err != nil {
+			return "", err
+		}
+		return "<todo_entries>\n" + FormatTodos(entries) + "</todo_entries>\n", nil
+
+	case "delete", "done", "undone":
+		num, ok := mapGet[float64](args, "number")
+		if !ok {
+			return "", fmt.Errorf("no number")
+		}
+
+		if action == "delete" {
+			if err := t.store.Delete(contextName, int(num)); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("deleted %d\n", int(num)), nil
+		}
+
+		if err := t.store.SetDone(contextName, int(num), action == "done"); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("marked %d %s\n", int(num), action), nil
+	}
+
+	return "", fmt.Errorf("invalid action %s", action)
+}
@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runTodo(t *testing.T, todo *Todo, args map[string]any) string {
+	raw, err := json.Marshal(args)
+	assert.NoError(t, err)
+	out, err := todo.Run(context.Background(), raw)
+	assert.NoError(t, err)
+	return out
+}
+
+func TestTodoPersistence(t *testing.T) {
+	db := testDB(t)
+
+	ag, err := NewAgent(db, nil, "first")
+	assert.NoError(t, err)
+
+	todo := NewTodo(ag.Todos())
+	assert.NoError(t, todo.Init(ag.GetContextWindow()))
+
+	runTodo(t, todo, map[string]any{"action": "add", "entry": "read logs"})
+	runTodo(t, todo, map[string]any{"action": "add", "entry": "fix bug"})
+	runTodo(t, todo, map[string]any{"action": "add", "entry": "ship"})
+	runTodo(t, todo, map[string]any{"action": "done", "number": 1})
+	runTodo(t, todo, map[string]any{"action": "delete", "number": 2})
+
+	out := runTodo(t, todo, map[string]any{"action": "list"})
+	assert.Equal(t,
+		"<todo_entries>\n1. [x] read logs\n2. [ ] ship\n</todo_entries>\n", out)
+
+	forked, err := NewAgentForked(db, nil, "second", "first")
+	assert.NoError(t, err)
+
+	entries, err := forked.Todos().List("second")
+	assert.NoError(t, err)
+	assert.Equal(t, "1. [x] read logs\n2. [ ] ship\n", FormatTodos(entries))
+
+	assert.NoError(t, ag.SwitchContext("empty"))
+	out = runTodo(t, todo, map[string]any{"action": "list"})
+	assert.Equal(t, "<todo_entries>\n</todo_entries>\n", out)
+
+	assert.NoError(t, ag.SwitchContext("first"))
+	runTodo(t, todo, map[string]any{"action": "undone", "number": 1})
+	entries, err = ag.Todos().List("first")
+	assert.NoError(t, err)
+	assert.False(t, entries[0].Done)
+}
@@ -0,0 +1,598 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBracketSyntax(t *testing.T) {
+	tests := []struct {
+		name     string
+		cmd      string
+		params   map[string]ToolParameter
+		args     map[string]interface{}
+		expected string
+	}{
+		{
+			name: "echo with flag included",
+			cmd:  "echo [-v {verbose}] {message}",
+			params: map[string]ToolParameter{
+				"verbose": {Type: "string", Required: false},
+				"message": {Type: "string", Required: true},
+			},
+			args: map[string]interface{}{
+				"verbose": "true",
+				"message": "hello",
+			},
+			expected: "echo -v true hello",
+		},
+		{
+			name: "echo with flag excluded",
+			cmd:  "echo [-v {verbose}] {message}",
+			params: map[string]ToolParameter{
+				"verbose": {Type: "string", Required: false},
+				"message": {Type: "string", Required: true},
+			},
+			args: map[string]interface{}{
+				"message": "hello",
+			},
+			expected: "echo hello",
+		},
+		{
+			name: "weird syntax with plus",
+			cmd:  "echo [+trace {level}] {message}",
+			params: map[string]ToolParameter{
+				"level":   {Type: "number", Required: false},
+				"message": {Type: "string", Required: true},
+			},
+			args: map[string]interface{}{
+				"level":   3,
+				"message": "test",
+			},
+			expected: "echo +trace 3 test",
+		},
+		{
+			name: "multiple brackets",
+			cmd:  "echo [-v] [--output {format}] {message}",
+			params: map[string]ToolParameter{
+				"format":  {Type: "string", Required: false},
+				"message": {Type: "string", Required: true},
+			},
+			args: map[string]interface{}{
+				"format":  "json",
+				"message": "test",
+			},
+			expected: "echo --output json test",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argv, err := expandCommand(tt.cmd, tt.params, tt.args)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, strings.Join(argv, " "))
+		})
+	}
+}
+
+func TestArgumentQuoting(t *testing.T) {
+	tests := []struct {
+		name     string
+		cmd      string
+		params   map[string]ToolParameter
+		args     map[string]interface{}
+		expected []string
+	}{
+		{
+			name: "value with spaces stays one argument",
+			cmd:  "get-logs --query {query}",
+			params: map[string]ToolParameter{
+				"query": {Type: "string", Required: true},
+			},
+			args: map[string]interface{}{
+				"query": `status:500 AND host:"web 1"`,
+			},
+			expected: []string{"get-logs", "--query", `status:500 AND host:"web 1"`},
+		},
+		{
+			name: "path with spaces inside optional flag",
+			cmd:  "ls [-d {dir}]",
+			params: map[string]ToolParameter{
+				"dir": {Type: "string"},
+			},
+			args: map[string]interface{}{
+				"dir": "/tmp/some dir",
+			},
+			expected: []string{"ls", "-d", "/tmp/some dir"},
+		},
+		{
+			name: "quoted template literal",
+			cmd:  `grep -e 'two words' {file}`,
+			params: map[string]ToolParameter{
+				"file": {Type: "string", Required: true},
+			},
+			args: map[string]interface{}{
+				"file": "a.log",
+			},
+			expected: []string{"grep", "-e", "two words", "a.log"},
+		},
+		{
+			name: "placeholder inside quoted template",
+			cmd:  `echo "prefix {msg}"`,
+			params: map[string]ToolParameter{
+				"msg": {Type: "string", Required: true},
+			},
+			args: map[string]interface{}{
+				"msg": "it's fine",
+			},
+			expected: []string{"echo", "prefix it's fine"},
+		},
+		{
+			name: "brackets inside quotes are literal",
+			cmd:  `jq '.[0]' {file}`,
+			params: map[string]ToolParameter{
+				"file": {Type: "string", Required: true},
+			},
+			args: map[string]interface{}{
+				"file": "x.json",
+			},
+			expected: []string{"jq", ".[0]", "x.json"},
+		},
+		{
+			name: "quotes in values are not interpreted",
+			cmd:  "echo {msg}",
+			params: map[string]ToolParameter{
+				"msg": {Type: "string", Required: true},
+			},
+			args: map[string]interface{}{
+				"msg": `"quoted" 'single' $HOME`,
+			},
+			expected: []string{"echo", `"quoted" 'single' $HOME`},
+		},
+		{
+			name: "empty value is an empty argument",
+			cmd:  "echo {msg} end",
+			params: map[string]ToolParameter{
+				"msg": {Type: "string", Required: true},
+			},
+			args: map[string]interface{}{
+				"msg": "",
+			},
+			expected: []string{"echo", "", "end"},
+		},
+		{
+			name: "absent optional placeholder is dropped",
+			cmd:  "echo {msg} end",
+			params: map[string]ToolParameter{
+				"msg": {Type: "string"},
+			},
+			args:     map[string]interface{}{},
+			expected: []string{"echo", "end"},
+		},
+		{
+			name: "large numbers are not rendered in exponent form",
+			cmd:  "head -n {lines}",
+			params: map[string]ToolParameter{
+				"lines": {Type: "number", Required: true},
+			},
+			args: map[string]interface{}{
+				"lines": float64(1000000),
+			},
+			expected: []string{"head", "-n", "1000000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argv, err := expandCommand(tt.cmd, tt.params, tt.args)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, argv)
+		})
+	}
+}
+
+func TestMissingRequiredParameter(t *testing.T) {
+	_, err := expandCommand("echo {msg}", map[string]ToolParameter{
+		"msg": {Type: "string", Required: true},
+	}, map[string]interface{}{})
+	assert.Error(t, err)
+}
+
+func TestShellJoin(t *testing.T) {
+	assert.Equal(t, `echo 'two words' '' 'it'\''s'`,
+		ShellJoin([]string{"echo", "two words", "", "it's"}))
+}
+
+func TestToolOutputLimits(t *testing.T) {
+	out, err := runCommand(context.Background(), ToolConfig{
+		Command:        "echo",
+		MaxOutputBytes: 5,
+	}, ToolHooks{}, []string{"echo", "hello world"})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello... + 7 bytes", out)
+
+	_, err = runCommand(context.Background(), ToolConfig{
+		Command: "sleep",
+		Timeout: 50 * time.Millisecond,
+	}, ToolHooks{}, []string{"sleep", "5"})
+	assert.ErrorIs(t, err, ErrToolTimeout)
+}
+
+func TestToolOutputSpillsOnFailure(t *testing.T) {
+	var spilled string
+	hooks := ToolHooks{
+		Spill: func(tool, output string) (string, error) {
+			spilled = output
+			return "<artifact>", nil
+		},
+	}
+
+	script := "printf 'error: %.0s' $(seq 100); exit 1"
+	_, err := runCommand(context.Background(), ToolConfig{
+		Name:       "logs",
+		Command:    "sh",
+		SpillBytes: 64,
+	}, hooks, []string{"sh", "-c", script})
+	assert.ErrorContains(t, err, "Output: <artifact>")
+	assert.Len(t, spilled, 700)
+
+	_, err = runCommand(context.Background(), ToolConfig{
+		Command:        "sh",
+		MaxOutputBytes: 7,
+	}, ToolHooks{}, []string{"sh", "-c", script})
+	assert.ErrorContains(t, err, "Output: error: ... + 693 bytes")
+}
+
+func TestToolTimeoutConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tools.toml")
+	err := os.WriteFile(path, []byte(`
+[[tool]]
+name = "slow"
+description = "slow"
+command = "sleep 10"
+timeout = "2s"
+max_output_bytes = 1024
+`), 0o644)
+	assert.NoError(t, err)
+
+	cfg, err := LoadToolConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, cfg.Tools[0].Timeout)
+	assert.Equal(t, 1024, cfg.Tools[0].MaxOutputBytes)
+}
+
+func TestParameterTypes(t *testing.T) {
+	params := map[string]ToolParameter{
+		"verbose": {Type: "boolean"},
+		"count":   {Type: "integer"},
+		"format":  {Type: "enum", Values: []string{"json", "text"}},
+		"tags":    {Type: "array"},
+		"query":   {Type: "string", Required: true},
+	}
+
+	tests := []struct {
+		name     string
+		cmd      string
+		args     map[string]interface{}
+		expected []string
+	}{
+		{
+			name: "true boolean switches its group on",
+			cmd:  "search [--verbose{verbose}] {query}",
+			args: map[string]interface{}{
+				"verbose": true,
+				"query":   "x",
+			},
+			expected: []string{"search", "--verbose", "x"},
+		},
+		{
+			name: "false boolean drops its group",
+			cmd:  "search [--verbose {verbose}] {query}",
+			args: map[string]interface{}{
+				"verbose": false,
+				"query":   "x",
+			},
+			expected: []string{"search", "x"},
+		},
+		{
+			name: "boolean outside a group renders as a word",
+			cmd:  "search --verbose={verbose} {query}",
+			args: map[string]interface{}{
+				"verbose": false,
+				"query":   "x",
+			},
+			expected: []string{"search", "--verbose=false", "x"},
+		},
+		{
+			name: "integer and enum",
+			cmd:  "search -n {count} --format {format} {query}",
+			args: map[string]interface{}{
+				"count":  float64(20),
+				"format": "json",
+				"query":  "x",
+			},
+			expected: []string{"search", "-n", "20", "--format", "json", "x"},
+		},
+		{
+			name: "array repeats its group",
+			cmd:  "search [--tag {tags}] {query}",
+			args: map[string]interface{}{
+				"tags":  []interface{}{"a b", "c"},
+				"query": "x",
+			},
+			expected: []string{"search", "--tag", "a b", "--tag", "c", "x"},
+		},
+		{
+			name: "bare array placeholder is one argument per element",
+			cmd:  "search {query} {tags}",
+			args: map[string]interface{}{
+				"tags":  []interface{}{"a", "b"},
+				"query": "x",
+			},
+			expected: []string{"search", "x", "a", "b"},
+		},
+		{
+			name: "array inside a larger token is comma-joined",
+			cmd:  "search --tags={tags} {query}",
+			args: map[string]interface{}{
+				"tags":  []interface{}{"a", "b"},
+				"query": "x",
+			},
+			expected: []string{"search", "--tags=a,b", "x"},
+		},
+		{
+			name: "empty array drops its group",
+			cmd:  "search [--tag {tags}] {query}",
+			args: map[string]interface{}{
+				"tags":  []interface{}{},
+				"query": "x",
+			},
+			expected: []string{"search", "x"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argv, err := expandCommand(tt.cmd, params, tt.args)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, argv)
+		})
+	}
+}
+
+func TestParameterValidation(t *testing.T) {
+	params := map[string]ToolParameter{
+		"verbose": {Type: "boolean"},
+		"count":   {Type: "integer"},
+		"format":  {Type: "enum", Values: []string{"json", "text"}},
+		"tags":    {Type: "array"},
+		"host":    {Type: "string"},
+		"ratio":   {Type: "number"},
+	}
+
+	bad := []map[string]interface{}{
+		{"host": float64(5)},
+		{"host": []interface{}{"a", "b"}},
+		{"ratio": "0.5"},
+		{"ratio": true},
+		{"verbose": "yes"},
+		{"count": 2.5},
+		{"count": "2"},
+		{"format": "xml"},
+		{"tags": "a,b"},
+		{"tags": []interface{}{"a", float64(1)}},
+	}
+
+	for _, args := range bad {
+		_, err := expandCommand("cmd {verbose} {count} {format} {tags} {host} {ratio}", params, args)
+		assert.Error(t, err, "%v", args)
+	}
+}
+
+func writeToolConfig(t *testing.T, dir, name, body string) string {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, os.WriteFile(path, []byte(body), 0o644))
+	return path
+}
+
+func TestInfoCommandBundles(t *testing.T) {
+	dir := t.TempDir()
+
+	single := writeToolConfig(t, dir, "single.toml", `
+name = "ping"
+description = "ping a host"
+command = "ping -c 1 {host}"
+
+[parameters]
+host = { description = "host", required = true }
+`)
+
+	bundle := writeToolConfig(t, dir, "bundle.toml", `
+[[tool]]
+name = "slack_search"
+description = "search slack"
+command = "agent-tools slack search {query}"
+
+[tool.parameters]
+query = { description = "query", required = true }
+
+[[tool]]
+name = "slack_history"
+description = "channel history"
+command = "agent-tools slack history {channel}"
+
+[tool.parameters]
+channel = { description = "channel", required = true }
+`)
+
+	path := writeToolConfig(t, dir, "tools.toml", `
+[[tool]]
+info_command = "cat `+single+`"
+
+[[tool]]
+info_command = "cat `+bundle+`"
+`)
+
+	cfg, err := LoadToolConfig(path)
+	assert.NoError(t, err)
+
+	var names []string
+	for _, tool := range cfg.Tools {
+		names = append(names, tool.Name)
+	}
+	assert.Equal(t, []string{"ping", "slack_search", "slack_history"}, names)
+	assert.Equal(t, "string", cfg.Tools[0].Parameters["host"].Type)
+	assert.True(t, cfg.Tools[2].Parameters["channel"].Required)
+}
+
+func TestInfoCommandBundleValidation(t *testing.T) {
+	dir := t.TempDir()
+
+	bundle := writeToolConfig(t, dir, "bundle.toml", `
+[[tool]]
+name = "good"
+description = "fine"
+command = "true"
+
+[[tool]]
+name = "broken"
+command = "true"
+`)
+
+	path := writeToolConfig(t, dir, "tools.toml", `
+[[tool]]
+info_command = "cat `+bundle+`"
+`)
+
+	_, err := LoadToolConfig(path)
+	assert.ErrorContains(t, err, "tool 'broken' must have a description")
+}
+
+func TestApprovalGate(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "ran")
+
+	tool := ToolConfig{
+		Name:    "mark",
+		Command: "touch {path}",
+		Confirm: true,
+		Parameters: map[string]ToolParameter{
+			"path": {Type: "string", Required: true},
+		},
+	}
+	args := []byte(`{"path":"` + target + `"}`)
+	argv := []string{"touch", target}
+
+	var asked []string
+	deny := func(ctx context.Context, tool string, argv []string) (bool, error) {
+		asked = append(asked, tool+": "+ShellJoin(argv))
+		return false, nil
+	}
+
+	out, err := generateCommand(tool, ToolHooks{Approve: deny})(context.Background(), args)
+	assert.NoError(t, err)
+	assert.Equal(t, deniedResult(argv), out)
+	assert.Equal(t, []string{"mark: touch " + target}, asked)
+	assert.NoFileExists(t, target)
+
+	out, err = generateCommand(tool, ToolHooks{})(context.Background(), args)
+	assert.NoError(t, err)
+	assert.Equal(t, deniedResult(argv), out)
+	assert.NoFileExists(t, target)
+
+	_, err = generateCommand(tool, ToolHooks{Approve: ApprovalPolicy("allow")})(context.Background(), args)
+	assert.NoError(t, err)
+	assert.FileExists(t, target)
+}
+
+func TestApprovalPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		spec, tool string
+		ok         bool
+	}{
+		{"deny", "ping", false},
+		{"", "ping", false},
+		{"allow", "rm", true},
+		{"ping, dig", "ping", true},
+		{"ping, dig", "dig", true},
+		{"ping, dig", "rm", false},
+	} {
+		ok, err := ApprovalPolicy(tc.spec)(ctx, tc.tool, []string{tc.tool})
+		assert.NoError(t, err)
+		assert.Equal(t, tc.ok, ok, "%s with -approve %q", tc.tool, tc.spec)
+	}
+}
+
+func TestApprovalReservedNames(t *testing.T) {
+	for _, name := range []string{"allow", "deny"} {
+		path := writeToolConfig(t, t.TempDir(), "tools.toml", `
+[[tool]]
+name = "`+name+`"
+description = "reserved"
+command = "true"
+`)
+		_, err := LoadToolConfig(path)
+		assert.ErrorContains(t, err, "reserved")
+	}
+}
+
+func TestInfoCommandInheritsSettings(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "ran")
+
+	bundle := writeToolConfig(t, dir, "bundle.toml", `
+[[tool]]
+name = "mark"
+description = "touch a file"
+command = "touch `+target+`"
+
+[[tool]]
+name = "quick"
+description = "quick"
+command = "true"
+timeout = "1s"
+confirm = false
+`)
+
+	path := writeToolConfig(t, dir, "tools.toml", `
+[[tool]]
+info_command = "cat `+bundle+`"
+confirm = true
+timeout = "30s"
+max_output_bytes = 4096
+spill_bytes = 8192
+`)
+
+	cfg, err := LoadToolConfig(path)
+	assert.NoError(t, err)
+
+	mark, quick := cfg.Tools[0], cfg.Tools[1]
+	assert.True(t, mark.Confirm)
+	assert.Equal(t, 30*time.Second, mark.Timeout)
+	assert.Equal(t, 4096, mark.MaxOutputBytes)
+	assert.Equal(t, 8192, mark.SpillBytes)
+	assert.True(t, quick.Confirm)
+	assert.Equal(t, time.Second, quick.Timeout)
+
+	var asked []string
+	hooks := ToolHooks{
+		Approve: func(ctx context.Context, tool string, argv []string) (bool, error) {
+			asked = append(asked, tool)
+			return false, nil
+		},
+	}
+
+	out, err := generateCommand(mark, hooks)(context.Background(), []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mark"}, asked)
+	assert.Contains(t, out, "<tool_denied>")
+	assert.NoFileExists(t, target)
+}
@@ -3,21 +3,25 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/google/shlex"
 	"github.com/superfly/contextwindow"
 )
 
 type ToolParameter struct {
-	Type        string `toml:"type"`
-	Description string `toml:"description"`
-	Required    bool   `toml:"required"`
+	Type        string   `toml:"type"`
+	Description string   `toml:"description"`
+	Required    bool     `toml:"required"`
+	Values      []string `toml:"values"`
 }
 
 type ToolConfig struct {
@@ -27,16 +31,27 @@ type ToolConfig struct {
 	InfoCommand string                   `toml:"info_command"`
 	Parameters  map[string]ToolParameter `toml:"parameters"`
 	Builtin     bool                     `toml:"builtin"`
+	Confirm     bool                     `toml:"confirm"`
+
+	Timeout        time.Duration `toml:"timeout"`
+	MaxOutputBytes int           `toml:"max_output_bytes"`
+	SpillBytes     int           `toml:"spill_bytes"`
 }
 
+var ErrToolTimeout = errors.New("tool timed out")
+
 type ToolsConfig struct {
 	Tools []ToolConfig `toml:"tool"`
 }
 
-func toolFromInfoCommand(cmdline string) (ret ToolConfig, err error) {
-	parts := strings.Fields(strings.Join(strings.Fields(cmdline), " "))
+func toolsFromInfoCommand(cmdline string) ([]ToolConfig, error) {
+	parts, err := shlex.Split(cmdline)
+	if err != nil {
+		return nil, fmt.Errorf("split command: %w", err)
+	}
+
 	if len(parts) == 0 {
-		return ret, fmt.Errorf("empty command")
+		return nil, fmt.Errorf("empty command")
 	}
 
 	cmd := exec.Command(parts[0], parts[1:]...)
@@ -44,14 +59,69 @@ func toolFromInfoCommand(cmdline string) (ret ToolConfig, err error) {
 
 	output, err := cmd.Output()
 	if err != nil {
-		return ret, fmt.Errorf("command failed: %w\nOutput: %s", err, string(output))
+		return nil, fmt.Errorf("command failed: %w\nOutput: %s", err, string(output))
+	}
+
+	return parseToolInfo(output)
+}
+
+// info_command output is either a whole tools.toml-style bundle of
+// [[tool]] entries or, for compatibility, a single bare tool with
+// top-level [parameters].
+func parseToolInfo(output []byte) ([]ToolConfig, error) {
+	var bundle ToolsConfig
+	if err := toml.Unmarshal(output, &bundle); err != nil {
+		return nil, fmt.Errorf("parse failed: %w\nOutput: %s", err, string(output))
+	}
+
+	if len(bundle.Tools) > 0 {
+		return bundle.Tools, nil
+	}
+
+	var single ToolConfig
+	if err := toml.Unmarshal(output, &single); err != nil {
+		return nil, fmt.Errorf("parse failed: %w\nOutput: %s", err, string(output))
+	}
+
+	return []ToolConfig{single}, nil
+}
+
+var toolNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+func validateTool(tool *ToolConfig) error {
+	if tool.Parameters == nil {
+		tool.Parameters = make(map[string]ToolParameter)
+	}
+
+	for paramName, param := range tool.Parameters {
+		if param.Type == "" {
+			param.Type = "string"
+			tool.Parameters[paramName] = param
+		}
+	}
+
+	if tool.Name == "" {
+		return fmt.Errorf("tool name cannot be empty")
+	}
+
+	if !toolNameRegex.MatchString(tool.Name) {
+		return fmt.Errorf("tool name '%s' contains invalid characters, must match [a-zA-Z0-9_-]", tool.Name)
+	}
+
+	// -approve allow and -approve deny would shadow them in an allowlist
+	if tool.Name == "allow" || tool.Name == "deny" {
+		return fmt.Errorf("tool name '%s' is reserved", tool.Name)
 	}
 
-	if err = toml.Unmarshal(output, &ret); err != nil {
-		return ret, fmt.Errorf("parse failed: %w\nOutput: %s", err, string(output))
+	if tool.Description == "" && !tool.Builtin {
+		return fmt.Errorf("tool '%s' must have a description", tool.Name)
 	}
 
-	return ret, nil
+	if tool.Command == "" && !tool.Builtin {
+		return fmt.Errorf("tool '%s' must have a command", tool.Name)
+	}
+
+	return nil
 }
 
 func LoadToolConfig(configPath string) (*ToolsConfig, error) {
@@ -64,121 +134,170 @@ func LoadToolConfig(configPath string) (*ToolsConfig, error) {
 		return nil, fmt.Errorf("parse tool config %s: %w", configPath, err)
 	}
 
-	for i := range config.Tools {
-		tool := &config.Tools[i]
+	var tools []ToolConfig
 
-		if tool.InfoCommand != "" {
-			tool, err := toolFromInfoCommand(tool.InfoCommand)
-			if err != nil {
-				return nil, fmt.Errorf("parse tool info: %w", err)
-			}
-			config.Tools[i] = tool
-		} else if tool.Parameters == nil {
-			tool.Parameters = make(map[string]ToolParameter)
-		} else {
-			for paramName, param := range tool.Parameters {
-				if param.Type == "" {
-					param.Type = "string"
-					tool.Parameters[paramName] = param
-				}
+	for _, tool := range config.Tools {
+		if tool.InfoCommand == "" {
+			if err := validateTool(&tool); err != nil {
+				return nil, err
 			}
+			tools = append(tools, tool)
+			continue
 		}
 
-		if !regexp.MustCompile(`^[a-zA-Z0-9_-]+$`).MatchString(tool.Name) {
-			return nil, fmt.Errorf("tool name '%s' contains invalid characters, must match [a-zA-Z0-9_-]", tool.Name)
-		}
-
-		if tool.Name == "" {
-			return nil, fmt.Errorf("tool name cannot be empty")
-		}
-
-		if tool.Description == "" && !tool.Builtin {
-			return nil, fmt.Errorf("tool '%s' must have a description", tool.Name)
+		bundle, err := toolsFromInfoCommand(tool.InfoCommand)
+		if err != nil {
+			return nil, fmt.Errorf("parse tool info: %w", err)
 		}
 
-		if tool.Command == "" && !tool.Builtin {
-			return nil, fmt.Errorf("tool '%s' must have a command", tool.Name)
+		for i := range bundle {
+			inheritSettings(&bundle[i], tool)
+			if err := validateTool(&bundle[i]); err != nil {
+				label := bundle[i].Name
+				if label == "" {
+					label = fmt.Sprintf("#%d", i+1)
+				}
+				return nil, fmt.Errorf("info_command \"%s\": tool %s: %w",
+					tool.InfoCommand, label, err)
+			}
 		}
+		tools = append(tools, bundle...)
 	}
 
+	config.Tools = tools
+
 	return &config, nil
 }
 
-var (
-	bracketRegex = regexp.MustCompile(`\[([^\[\]]+)\]`)
-	paramRegex   = regexp.MustCompile(`\{(\w+)\}`)
-)
+// settings on an info_command entry apply to every tool it produces,
+// unless the tool sets its own. a tool can't turn off the entry's
+// confirm, though.
+func inheritSettings(tool *ToolConfig, entry ToolConfig) {
+	tool.Confirm = tool.Confirm || entry.Confirm
+
+	if tool.Timeout == 0 {
+		tool.Timeout = entry.Timeout
+	}
+	if tool.MaxOutputBytes == 0 {
+		tool.MaxOutputBytes = entry.MaxOutputBytes
+	}
+	if tool.SpillBytes == 0 {
+		tool.SpillBytes = entry.SpillBytes
+	}
+}
+
+var paramRegex = regexp.MustCompile(`\{(\w+)\}`)
 
 type simpleToolFunction func(context.Context, json.RawMessage) (string, error)
 
+type Approver func(ctx context.Context, tool string, argv []string) (bool, error)
+
+type ToolHooks struct {
+	Approve Approver
+	Spill   func(tool, output string) (string, error)
+}
+
+func deniedResult(argv []string) string {
+	return fmt.Sprintf("<tool_denied>\nThe user denied this call: %s\n"+
+		"Do not retry it; ask the user how to proceed.\n</tool_denied>\n",
+		ShellJoin(argv))
+}
+
+func (h ToolHooks) approve(ctx context.Context, tool string, argv []string) (bool, error) {
+	if h.Approve == nil {
+		return false, nil
+	}
+	return h.Approve(ctx, tool, argv)
+}
+
 func generateCommand(
-	cmd string,
-	params map[string]ToolParameter,
+	tool ToolConfig,
+	hooks ToolHooks,
 ) simpleToolFunction {
+	cmd := tool.Command
+	params := tool.Parameters
+
 	return func(ctx context.Context, args json.RawMessage) (string, error) {
 		var parsedArgs map[string]interface{}
 		if err := json.Unmarshal(args, &parsedArgs); err != nil {
 			return "", fmt.Errorf("execute tool \"%s\": failed to parse arguments: %w", cmd, err)
 		}
 
-		cmdStr := cmd
+		cmdParts, err := expandCommand(cmd, params, parsedArgs)
+		if err != nil {
+			return "", fmt.Errorf("execute tool \"%s\": %w", cmd, err)
+		}
 
-		// for each [optional] [--flag], extract the flag, see
-		// if we have the needed {params} to expand it, otherwise
-		// zap the whole [--optional flag].
-		//
-		// ie, for "tcpdump tcp [and port {port}]", when {port}
-		// is optional.
+		if len(cmdParts) == 0 {
+			return "", fmt.Errorf("execute tool \"%s\": empty command", cmd)
+		}
 
-		for {
-			matches := bracketRegex.FindStringSubmatch(cmdStr)
-			if matches == nil {
-				break
+		if tool.Confirm {
+			ok, err := hooks.approve(ctx, tool.Name, cmdParts)
+			if err != nil {
+				return "", fmt.Errorf("execute tool \"%s\": approval: %w", cmd, err)
 			}
-
-			optionalFlag := matches[1]
-			if hasAllParameters(optionalFlag, parsedArgs) {
-				cmdStr = strings.Replace(cmdStr, matches[0], optionalFlag, 1)
-			} else {
-				cmdStr = strings.Replace(cmdStr, matches[0], "", 1)
+			if !ok {
+				return deniedResult(cmdParts), nil
 			}
 		}
 
-		// now substitute in the parameters themselves
-
-		for paramName := range params {
-			value, exists := parsedArgs[paramName]
-			if exists && value != nil {
-				cmdStr = paramRegex.ReplaceAllStringFunc(
-					cmdStr,
-					func(match string) string {
-						if match == fmt.Sprintf("{%s}", paramName) {
-							return fmt.Sprintf("%v", value)
-						}
-						return match
-					})
-			} else if params[paramName].Required {
-				return "", fmt.Errorf("execute tool \"%s\": required parameter %s not provided", cmd, paramName)
-			}
-		}
+		return runCommand(ctx, tool, hooks, cmdParts)
+	}
+}
 
-		// now run the command
+func runCommand(
+	ctx context.Context,
+	tool ToolConfig,
+	hooks ToolHooks,
+	argv []string,
+) (string, error) {
+	if tool.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, tool.Timeout)
+		defer cancel()
+	}
 
-		cmdStr = strings.Join(strings.Fields(cmdStr), " ")
+	limit := func(b []byte) string {
+		if tool.MaxOutputBytes <= 0 {
+			return string(b)
+		}
+		return truncate(string(b), tool.MaxOutputBytes)
+	}
 
-		cmdParts := strings.Fields(cmdStr)
-		if len(cmdParts) == 0 {
-			return "", fmt.Errorf("execute tool \"%s\": empty command", cmd)
+	// a failed command's output can be just as big (a stack trace, a
+	// log query's stderr), so it gets the same treatment.
+	fit := func(b []byte) (string, error) {
+		if tool.SpillBytes > 0 && len(b) > tool.SpillBytes && hooks.Spill != nil {
+			return hooks.Spill(tool.Name, string(b))
 		}
+		return limit(b), nil
+	}
 
-		execCmd := exec.CommandContext(ctx, cmdParts[0], cmdParts[1:]...)
-		output, err := execCmd.CombinedOutput()
+	failed := func(b []byte) string {
+		out, err := fit(b)
 		if err != nil {
-			return "", fmt.Errorf("command failed: %w\nOutput: %s", err, string(output))
+			return limit(b)
 		}
+		return out
+	}
+
+	execCmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	execCmd.WaitDelay = time.Second
+	output, err := execCmd.CombinedOutput()
 
-		return string(output), nil
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("execute tool \"%s\": %w after %s\nOutput: %s",
+			tool.Command, ErrToolTimeout, tool.Timeout, failed(output))
 	}
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("execute tool \"%s\": %w", tool.Command, ctx.Err())
+	}
+	if err != nil {
+		return "", fmt.Errorf("command failed: %w\nOutput: %s", err, failed(output))
+	}
+
+	return fit(output)
 }
 
 // TODO(tqbf): this is repulsive but whatever
@@ -212,14 +331,8 @@ func loadBuiltin(cw *contextwindow.ContextWindow, cfg ToolConfig) error {
 
 	tool := contextwindow.NewTool(builtinCfg.Name, builtinCfg.Description)
 	for pk, pv := range builtinCfg.Parameters {
-		switch pv.Type {
-		case "string":
-			tool = tool.AddStringParameter(pk, pv.Description, pv.Required)
-		case "number":
-			tool = tool.AddNumberParameter(pk, pv.Description, pv.Required)
-		default:
-			return fmt.Errorf("load builtin %s: unknown parameter type \"%s\"",
-				builtinCfg.Name, pv.Type)
+		if err := addParameter(tool, pk, pv); err != nil {
+			return fmt.Errorf("load builtin %s: %w", builtinCfg.Name, err)
 		}
 	}
 
@@ -231,7 +344,34 @@ func loadBuiltin(cw *contextwindow.ContextWindow, cfg ToolConfig) error {
 	return nil
 }
 
-func LoadTools(cw *contextwindow.ContextWindow, cfg *ToolsConfig) error {
+func addParameter(tool *contextwindow.ToolBuilder, name string, p ToolParameter) error {
+	switch p.Type {
+	case "string", "":
+		tool.AddStringParameter(name, p.Description, p.Required)
+	case "number":
+		tool.AddNumberParameter(name, p.Description, p.Required)
+	case "integer":
+		tool.AddNumberParameter(name, p.Description+" (an integer)", p.Required)
+	case "boolean":
+		tool.AddBooleanParameter(name, p.Description, p.Required)
+	case "enum":
+		if len(p.Values) == 0 {
+			return fmt.Errorf("enum parameter %s has no values", name)
+		}
+		tool.AddStringParameter(name,
+			fmt.Sprintf("%s (one of: %s)", p.Description, strings.Join(p.Values, ", ")),
+			p.Required)
+	case "array":
+		tool.AddArrayParameter(name, p.Description, p.Required,
+			contextwindow.ParameterTypeString)
+	default:
+		return fmt.Errorf("unknown parameter type \"%s\" for %s", p.Type, name)
+	}
+
+	return nil
+}
+
+func LoadTools(cw *contextwindow.ContextWindow, cfg *ToolsConfig, hooks ToolHooks) error {
 	for _, toolCfg := range cfg.Tools {
 		if toolCfg.Builtin {
 			if err := loadBuiltin(cw, toolCfg); err != nil {
@@ -244,20 +384,14 @@ func LoadTools(cw *contextwindow.ContextWindow, cfg *ToolsConfig) error {
 			toolCfg.Name,
 			toolCfg.Description)
 		for pk, pv := range toolCfg.Parameters {
-			switch pv.Type {
-			case "string":
-				tool = tool.AddStringParameter(pk, pv.Description, pv.Required)
-			case "number":
-				tool = tool.AddNumberParameter(pk, pv.Description, pv.Required)
-			default:
-				return fmt.Errorf("load tools: unknown parameter type \"%s\" for %s",
-					pv.Type, toolCfg.Name)
+			if err := addParameter(tool, pk, pv); err != nil {
+				return fmt.Errorf("load tools: %s: %w", toolCfg.Name, err)
 			}
 		}
 
 		cw.AddTool(tool,
 			contextwindow.ToolRunnerFunc(
-				generateCommand(toolCfg.Command, toolCfg.Parameters),
+				generateCommand(toolCfg, hooks),
 			))
 	}
 
@@ -282,3 +416,22 @@ func hasAllParameters(fragment string, args map[string]interface{}) bool {
 	}
 	return true
 }
+
+func ApprovalPolicy(spec string) Approver {
+	allowed := map[string]bool{}
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			allowed[name] = true
+		}
+	}
+
+	return func(ctx context.Context, tool string, argv []string) (bool, error) {
+		switch {
+		case allowed["allow"]:
+			return true, nil
+		case allowed["deny"]:
+			return false, nil
+		}
+		return allowed[tool], nil
+	}
+}
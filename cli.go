@@ -0,0 +1,245 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/superfly/contextwindow"
+	"gopkg.in/yaml.v3"
+
+	"smiley/agent"
+)
+
+// subcommands run instead of the agent when named, dash and all, as
+// the first argument, like "smiley -search zookeeper". a bare word
+// would take prompts that happen to start with one, and flags can't.
+var subcommands = map[string]func(args []string) int{
+	"search":         runSearch,
+	"export-fixture": runExportFixture,
+	"replay":         runReplay,
+}
+
+// takes -name or --name, like the flag package does.
+func subcommand(args []string) (func(args []string) int, bool) {
+	if len(args) == 0 || !strings.HasPrefix(args[0], "-") {
+		return nil, false
+	}
+
+	name := strings.TrimPrefix(strings.TrimPrefix(args[0], "-"), "-")
+	run, ok := subcommands[name]
+	return run, ok
+}
+
+func openDB(path string) (*sql.DB, error) {
+	if path == "" {
+		cfgdir, err := agent.EnsureCtxAgentDir()
+		if err != nil {
+			return nil, fmt.Errorf("find ~/.ctxagent: %w", err)
+		}
+		path = filepath.Join(cfgdir, "contextwindow.db")
+	}
+
+	db, err := contextwindow.NewContextDB(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+
+	if err := agent.InitializeSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func runSearch(args []string) int {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	var (
+		dbPath = fs.String("db", "", "Path to contextwindow.db")
+		limit  = fs.Int("limit", 20, "Maximum number of results")
+	)
+	configPath, profile := configFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "smiley -search [options] <query>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := applyConfig(fs, *configPath, *profile, false); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	query := strings.Join(fs.Args(), " ")
+	if query == "" {
+		fs.Usage()
+		return 2
+	}
+
+	db, err := openDB(*dbPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	hits, err := agent.SearchRecords(db, query, *limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	for _, h := range hits {
+		fmt.Printf("%s #%d: %s\n", h.Context, h.Index, h.Snippet)
+	}
+
+	if len(hits) == 0 {
+		return 1
+	}
+
+	return 0
+}
+
+func runExportFixture(args []string) int {
+	fs := flag.NewFlagSet("export-fixture", flag.ExitOnError)
+	var (
+		dbPath = fs.String("db", "", "Path to contextwindow.db")
+		out    = fs.String("o", "", "Write the fixture here instead of stdout")
+	)
+	configPath, profile := configFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "smiley -export-fixture [options] <conversation>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := applyConfig(fs, *configPath, *profile, false); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	db, err := openDB(*dbPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	fx, err := agent.ExportFixture(db, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	buf, err := yaml.Marshal(fx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *out == "" {
+		if _, err := fmt.Fprint(os.Stdout, string(buf)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	if err := os.WriteFile(*out, buf, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+// replays run in a scratch database, so the tools' side effects on
+// todos, notes, and artifacts don't land in the real one.
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	var (
+		toolConfig = fs.String("tools", "", "Path to tools.toml (default ~/.ctxagent/tools.toml)")
+		approve    = fs.String("approve", "deny", "Policy for confirm=true tools: deny, allow, or a comma-separated list of tool names to allow")
+	)
+	configPath, profile := configFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "smiley -replay [options] <fixture.yaml>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := applyConfig(fs, *configPath, *profile, false); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	fx, err := agent.LoadFixture(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	path := *toolConfig
+	if path == "" {
+		cfgdir, err := agent.EnsureCtxAgentDir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "find ~/.ctxagent: %v\n", err)
+			return 1
+		}
+		path = filepath.Join(cfgdir, "tools.toml")
+	}
+
+	db, err := contextwindow.NewContextDB(":memory:")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ag, err := agent.NewAgent(db, nil, "replay")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	registerBuiltins(ag)
+	ag.Approve = agent.ApprovalPolicy(*approve)
+
+	if err := ag.LoadTools(path); err != nil {
+		fmt.Fprintf(os.Stderr, "loading tool definitions from %s: %v\n", path, err)
+		return 1
+	}
+
+	mismatches, err := ag.Replay(fx)
+	for _, m := range mismatches {
+		fmt.Println(m)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("%d turns replayed, %d tool outputs changed\n",
+		len(fx.Turns), len(mismatches))
+
+	if len(mismatches) > 0 {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+
+	"smiley/agent"
+)
+
+// sets fs's flags from config.toml (the one named by -config, or the
+// default) with profile on top. the agent's own flags cover every
+// option, so it's strict; subcommands only take the options they have.
+func applyConfig(fs *flag.FlagSet, path, profile string, strict bool) error {
+	explicit := path != ""
+	if !explicit {
+		path = agent.DefaultConfigPath()
+	}
+
+	cfg, err := agent.LoadConfig(path, profile, explicit)
+	if err != nil {
+		return err
+	}
+
+	return cfg.Apply(fs, strict)
+}
+
+// subcommands take -config and -profile like the agent does.
+func configFlags(fs *flag.FlagSet) (path, profile *string) {
+	path = fs.String("config", "", "Path to config.toml")
+	profile = fs.String("profile", "", "Named [profile.<name>] from config.toml to apply")
+	return path, profile
+}
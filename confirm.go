@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/wordwrap"
+
+	"smiley/agent"
+)
+
+type msgShowModal struct {
+	modal tea.Model
+}
+
+// closes modal if it's set, wherever it is, otherwise the one showing.
+type msgCloseModal struct {
+	modal tea.Model
+}
+
+type ConfirmModal struct {
+	title    string
+	body     string
+	width    int
+	onAnswer func(bool) tea.Msg
+}
+
+func NewConfirmModal(title, body string, onAnswer func(bool) tea.Msg) *ConfirmModal {
+	return &ConfirmModal{
+		title:    title,
+		body:     body,
+		width:    60,
+		onAnswer: onAnswer,
+	}
+}
+
+func (m *ConfirmModal) Init() tea.Cmd {
+	return nil
+}
+
+func (m *ConfirmModal) answer(ok bool) tea.Cmd {
+	return tea.Sequence(
+		func() tea.Msg {
+			return msgCloseModal{}
+		},
+		func() tea.Msg {
+			return m.onAnswer(ok)
+		},
+	)
+}
+
+func (m *ConfirmModal) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	km, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+
+	switch km.String() {
+	case "y", "Y", "enter":
+		return m, m.answer(true)
+	case "n", "N", "esc":
+		return m, m.answer(false)
+	}
+
+	return m, nil
+}
+
+func (m *ConfirmModal) View() string {
+	header := lipgloss.NewStyle().
+		Width(m.width - 4).
+		Foreground(lipgloss.Color("230")).
+		Render(m.title)
+
+	body := lipgloss.NewStyle().
+		Width(m.width - 4).
+		Foreground(lipgloss.Color("#dd9f6b")).
+		Render(wordwrap.String(m.body, m.width-6))
+
+	footer := lipgloss.NewStyle().
+		Width(m.width - 4).
+		Foreground(lipgloss.Color("240")).
+		Render("y/Enter: approve  n/Esc: deny")
+
+	modalContent := lipgloss.JoinVertical(
+		lipgloss.Left,
+		header,
+		"",
+		body,
+		"",
+		footer,
+	)
+
+	modalStyle := lipgloss.NewStyle().
+		Width(m.width).
+		Padding(1, 2).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("62")).
+		Background(lipgloss.Color("235")).
+		Foreground(lipgloss.Color("230"))
+
+	return modalStyle.Render(modalContent)
+}
+
+func tuiApprover(p *tea.Program) agent.Approver {
+	return func(ctx context.Context, tool string, argv []string) (bool, error) {
+		reply := make(chan bool, 1)
+
+		confirm := NewConfirmModal(
+			"Run "+tool+"?",
+			agent.ShellJoin(argv),
+			func(ok bool) tea.Msg {
+				reply <- ok
+				return nil
+			})
+		p.Send(msgShowModal{modal: confirm})
+
+		select {
+		case ok := <-reply:
+			return ok, nil
+		case <-ctx.Done():
+			p.Send(msgCloseModal{modal: confirm})
+			return false, ctx.Err()
+		}
+	}
+}
@@ -17,8 +17,25 @@ type msgPromptUpdate string
 type msgModelResponse string
 type msgWorking bool
 type msgSelectContext string
+type msgJumpToRecord struct {
+	context string
+	record  int64
+}
+
+// what selectContext's switch found, back on the Update loop.
+type msgContextSwitched struct {
+	record     int64
+	records    []contextwindow.Record
+	model      string
+	restoreErr error
+}
+
 type msgTokenUsage float64
 type msgSlashCommand []string
+type msgCancelTurn struct{}
+type msgCancelled struct{}
+type msgPressure agent.PressureMsg
+type msgModelChanged string
 
 type msgToolCall struct {
 	name     string
@@ -58,8 +75,12 @@ func viewLog(msg string, style lipgloss.Style) tea.Cmd {
 	}
 }
 
+func endStream() tea.Msg {
+	return msgViewportStreamEnd{}
+}
+
 func checkForFollowups(text string) tea.Cmd {
-	options := parseFollowups(text)
+	options := agent.ParseFollowups(text)
 	if options != nil && len(options) > 9 {
 		options = nil
 	}
@@ -120,12 +141,25 @@ type TUIAgentController struct {
 
 func (t *TUIAgentController) Update(msg tea.Msg) (Controller, tea.Cmd) {
 	switch msg := msg.(type) {
+	case msgInit:
+		name := t.agent.ModelName()
+		return t, func() tea.Msg {
+			return msgModelChanged(name)
+		}
+
 	case msgModelResponse:
 		cmds := []tea.Cmd{
+			endStream,
 			viewLog(string(msg)+"\n", styleResponseText),
 			checkForFollowups(string(msg)),
 		}
-		return t, tea.Batch(cmds...)
+		return t, tea.Sequence(cmds...)
+
+	case msgWorking:
+		if !msg {
+			return t, endStream
+		}
+		return t, nil
 
 	case msgToolCall:
 		if *optLogTools {
@@ -138,7 +172,33 @@ func (t *TUIAgentController) Update(msg tea.Msg) (Controller, tea.Cmd) {
 		return t, nil
 
 	case msgSelectContext:
-		return t.selectContext(string(msg))
+		return t.selectContext(string(msg), 0)
+
+	case msgJumpToRecord:
+		return t.selectContext(msg.context, msg.record)
+
+	case msgContextSwitched:
+		return t, t.contextSwitched(msg)
+
+	case msgCancelTurn:
+		if !t.agent.Cancel() {
+			return t, nil
+		}
+		return t, viewLog("cancelling...\n", styleErrorText)
+
+	case msgCancelled:
+		return t, viewLog("cancelled\n", styleErrorText)
+
+	case msgPressure:
+		log := viewLog("context pressure: "+msg.Msg+"\n", styleErrorText)
+		if msg.Strategy != agent.PressureWarn {
+			return t, log
+		}
+		return t, tea.Batch(log, func() tea.Msg {
+			return msgShowModal{
+				modal: NewModal("Context window filling up", msg.Msg),
+			}
+		})
 
 	case msgFollowupSelected:
 		if string(msg) != "" {
@@ -165,41 +225,82 @@ func (t *TUIAgentController) Update(msg tea.Msg) (Controller, tea.Cmd) {
 	return t, nil
 }
 
-func (t *TUIAgentController) selectContext(name string) (Controller, tea.Cmd) {
-	err := t.agent.SwitchContext(name)
-	if err != nil {
-		slog.Error("switch context", "error", err)
-		return t, nil
+func (t *TUIAgentController) scrollTo(records []contextwindow.Record, id int64) tea.Cmd {
+	for _, r := range records {
+		if r.ID == id {
+			return func() tea.Msg {
+				return msgScrollToRecord(id)
+			}
+		}
 	}
 
-	records, err := t.agent.GetContextWindow().LiveRecords()
-	if err != nil {
-		slog.Error("read records", "error", err)
-		return t, nil
+	return viewLog("(that record is no longer live; C-t shows the whole transcript)\n",
+		styleErrorText)
+}
+
+// switching waits for any turn in progress to finish, so it happens
+// off the Update loop, like the other context operations. if record is
+// set, the log scrolls to it once it's rendered.
+func (t *TUIAgentController) selectContext(name string, record int64) (Controller, tea.Cmd) {
+	return t, func() tea.Msg {
+		// a conversation whose saved settings can't all be restored is
+		// still switched to; what couldn't be keeps the setting in
+		// effect.
+		var restoreErr error
+
+		err := t.agent.SwitchContext(name)
+		if err != nil {
+			slog.Error("switch context", "error", err)
+			if t.agent.ContextName() != name {
+				return msgViewportLog{Msg: err.Error() + "\n", Style: styleErrorText}
+			}
+			restoreErr = err
+		}
+
+		records, err := t.agent.GetContextWindow().LiveRecords()
+		if err != nil {
+			slog.Error("read records", "error", err)
+			return msgViewportLog{Msg: err.Error() + "\n", Style: styleErrorText}
+		}
+
+		return msgContextSwitched{
+			record:     record,
+			records:    records,
+			model:      t.agent.ModelName(),
+			restoreErr: restoreErr,
+		}
 	}
+}
+
+func (t *TUIAgentController) contextSwitched(msg msgContextSwitched) tea.Cmd {
+	records := msg.records
 
 	resetMsg := []msgViewportLog{}
 	for _, r := range records {
 		switch r.Source {
 		case contextwindow.Prompt:
 			resetMsg = append(resetMsg, msgViewportLog{
-				Style: stylePromptText,
-				Msg:   r.Content,
+				Style:    stylePromptText,
+				Msg:      r.Content,
+				RecordID: r.ID,
 			})
 		case contextwindow.ModelResp:
 			resetMsg = append(resetMsg, msgViewportLog{
-				Style: styleResponseText,
-				Msg:   r.Content,
+				Style:    styleResponseText,
+				Msg:      r.Content,
+				RecordID: r.ID,
 			})
 		case contextwindow.ToolCall:
 			resetMsg = append(resetMsg, msgViewportLog{
-				Style: styleToolLogText,
-				Msg:   r.Content,
+				Style:    styleToolLogText,
+				Msg:      r.Content,
+				RecordID: r.ID,
 			})
 		case contextwindow.ToolOutput:
 			resetMsg = append(resetMsg, msgViewportLog{
-				Style: styleToolResponseText,
-				Msg:   r.Content,
+				Style:    styleToolResponseText,
+				Msg:      r.Content,
+				RecordID: r.ID,
 			})
 		}
 	}
@@ -211,6 +312,13 @@ func (t *TUIAgentController) selectContext(name string) (Controller, tea.Cmd) {
 		func() tea.Msg {
 			return msgSwitchScreen(screenLog)
 		},
+		func() tea.Msg {
+			return msgModelChanged(msg.model)
+		},
+	}
+
+	if msg.restoreErr != nil {
+		cmds = append(cmds, viewLog(msg.restoreErr.Error()+"\n", styleErrorText))
 	}
 
 	for i := len(records) - 1; i >= 0; i-- {
@@ -222,5 +330,9 @@ func (t *TUIAgentController) selectContext(name string) (Controller, tea.Cmd) {
 		}
 	}
 
-	return t, tea.Sequence(cmds...)
+	if msg.record != 0 {
+		cmds = append(cmds, t.scrollTo(records, msg.record))
+	}
+
+	return tea.Sequence(cmds...)
 }
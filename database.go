@@ -3,41 +3,91 @@ package main
 import (
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/superfly/contextwindow"
+
+	"smiley/agent"
 )
 
-type msgContextTableRows []table.Row
+type msgContextTable struct {
+	contexts []agent.ContextSummary
+	err      error
+}
+type msgRefreshContexts struct{}
+
+type msgRenameContext struct{ from, to string }
+type msgDeleteContext struct {
+	name string
+	ok   bool
+}
+type msgForkContext struct{ from, to string }
 
 type DatabaseView struct {
-	id      string
-	cw      *contextwindow.ContextWindow
-	w, h    int
-	table   table.Model
-	focused bool
+	id        string
+	agent     *agent.Agent
+	cw        *contextwindow.ContextWindow
+	w, h      int
+	table     table.Model
+	filter    textinput.Model
+	filtering bool
+	focused   bool
+
+	contexts  []agent.ContextSummary
+	err       error
+	sortCol   int
+	sortDesc  bool
+	showEmpty bool
 }
 
-func NewDatabaseView(id string, cw *contextwindow.ContextWindow) *DatabaseView {
-	cols := []table.Column{
-		{Title: "Name", Width: 30},
-		{Title: "Tokens", Width: 10},
-		{Title: "Start", Width: 20},
-		{Title: "Duration", Width: 20},
+var contextColumns = []struct {
+	title string
+	width int
+	less  func(a, b agent.ContextSummary) bool
+}{
+	{"Name", 30, func(a, b agent.ContextSummary) bool { return a.Name < b.Name }},
+	{"Created", 17, func(a, b agent.ContextSummary) bool { return a.Created.Before(b.Created) }},
+	{"Last active", 22, func(a, b agent.ContextSummary) bool { return a.LastActive.Before(b.LastActive) }},
+	{"Tokens (live/all)", 18, func(a, b agent.ContextSummary) bool {
+		return pairLess(a.LiveTokens, a.TotalTokens, b.LiveTokens, b.TotalTokens)
+	}},
+	{"Records", 10, func(a, b agent.ContextSummary) bool {
+		return pairLess(a.LiveRecords, a.Records, b.LiveRecords, b.Records)
+	}},
+	{"Model", 30, func(a, b agent.ContextSummary) bool { return a.Model < b.Model }},
+}
+
+// sorts "live/all" columns the way they read: by live, then by all.
+func pairLess(aLive, aAll, bLive, bAll int) bool {
+	if aLive != bLive {
+		return aLive < bLive
 	}
+	return aAll < bAll
+}
 
-	return &DatabaseView{
-		id: id,
-		cw: cw,
-		table: table.New(
-			table.WithFocused(true),
-			table.WithColumns(cols),
-		),
+func NewDatabaseView(id string, ag *agent.Agent) *DatabaseView {
+	filter := textinput.New()
+	filter.Prompt = "/"
+	filter.Placeholder = "filter by name or content"
+
+	s := &DatabaseView{
+		id:       id,
+		agent:    ag,
+		cw:       ag.GetContextWindow(),
+		filter:   filter,
+		sortCol:  2,
+		sortDesc: true,
+		table:    table.New(table.WithFocused(true)),
 	}
+	s.setColumns()
+
+	return s
 }
 
 func humanDuration(d time.Duration) string {
@@ -76,51 +126,109 @@ func plural(n int) string {
 	return "s"
 }
 
-func (s *DatabaseView) refreshTable() tea.Msg {
-	contexts, err := s.cw.ListContexts()
+func relativeTime(t time.Time) string {
+	if t.IsZero() {
+		return "(no activity)"
+	}
+
+	return humanDuration(time.Since(t)) + " ago"
+}
+
+// the filter is read now, on the Update loop, not in the command.
+func (s *DatabaseView) refreshTable() tea.Cmd {
+	query := strings.TrimSpace(s.filter.Value())
+
+	return func() tea.Msg {
+		return s.loadTable(query)
+	}
+}
+
+func (s *DatabaseView) loadTable(query string) tea.Msg {
+	contexts, err := s.agent.ContextSummaries()
 	if err != nil {
 		slog.Info("refresh context", "error", err)
-		// TODO(tqbf): percolate an error
-		return nil
+		return msgContextTable{err: err}
 	}
 
-	rows := []table.Row{}
-
-	for _, context := range contexts {
-		stats, err := s.cw.GetContextStats(context)
+	if query != "" {
+		matches, err := s.agent.MatchContexts(query)
 		if err != nil {
-			slog.Info("fetch context", "context", context, "error", err)
-			continue
+			slog.Info("filter contexts", "error", err)
+			return msgContextTable{err: err}
 		}
 
-		var (
-			name       = context.Name
-			tokens     = stats.LiveTokens
-			start      = context.StartTime
-			activeTime = "(no activity)"
-		)
+		contexts = slices.DeleteFunc(contexts, func(c agent.ContextSummary) bool {
+			return !matches[c.Name]
+		})
+	}
+
+	return msgContextTable{contexts: contexts}
+}
 
-		if tokens == 0 {
-			continue
+func (s *DatabaseView) setColumns() {
+	cols := make([]table.Column, len(contextColumns))
+	for i, c := range contextColumns {
+		title := c.title
+		if i == s.sortCol {
+			title += " ▲"
+			if s.sortDesc {
+				title = c.title + " ▼"
+			}
 		}
+		cols[i] = table.Column{Title: title, Width: c.width}
+	}
+
+	s.table.SetColumns(cols)
+}
+
+func (s *DatabaseView) setRows() {
+	contexts := slices.Clone(s.contexts)
+
+	if !s.showEmpty {
+		contexts = slices.DeleteFunc(contexts, agent.ContextSummary.Empty)
+	}
+
+	less := contextColumns[s.sortCol].less
+	slices.SortStableFunc(contexts, func(a, b agent.ContextSummary) int {
+		switch {
+		case less(a, b):
+			return -1
+		case less(b, a):
+			return 1
+		}
+		return 0
+	})
+	if s.sortDesc {
+		slices.Reverse(contexts)
+	}
+
+	rows := []table.Row{}
 
-		if stats.LastActivity != nil {
-			activeTime = humanDuration(start.Sub(*stats.LastActivity))
+	for _, c := range contexts {
+		model := c.Model
+		if model == "" {
+			model = "-"
 		}
 
-		rows = append(rows, []string{
-			name,
-			fmt.Sprintf("%d tokens", tokens),
-			fmt.Sprintf("%s", start),
-			activeTime,
+		rows = append(rows, table.Row{
+			c.Name,
+			c.Created.Local().Format("2006-01-02 15:04"),
+			relativeTime(c.LastActive),
+			fmt.Sprintf("%d/%d", c.LiveTokens, c.TotalTokens),
+			fmt.Sprintf("%d/%d", c.LiveRecords, c.Records),
+			model,
 		})
 	}
 
-	return msgContextTableRows(rows)
+	s.setColumns()
+	s.table.SetRows(rows)
+	if s.table.Cursor() >= len(rows) {
+		s.table.SetCursor(max(len(rows)-1, 0))
+	}
 }
 
 func (s *DatabaseView) Init() tea.Cmd {
-	return s.refreshTable
+	return s.refreshTable()
 }
 
 func (s *DatabaseView) Update(msg tea.Msg) (ret tea.Model, cmd tea.Cmd) {
@@ -133,34 +241,103 @@ func (s *DatabaseView) Update(msg tea.Msg) (ret tea.Model, cmd tea.Cmd) {
 	case msgInit:
 		return s, s.Init()
 
-	case msgContextTableRows:
-		s.table.SetRows([]table.Row(msg))
+	case msgContextTable:
+		s.err = msg.err
+		if msg.err == nil {
+			s.contexts = msg.contexts
+			s.setRows()
+		}
+
+	case msgRefreshContexts:
+		return s, s.refreshTable()
+
+	case msgRenameContext:
+		return s, s.run(func() error {
+			return s.agent.RenameContext(msg.from, msg.to)
+		})
+
+	case msgDeleteContext:
+		if !msg.ok {
+			break
+		}
+		return s, s.run(func() error {
+			return s.agent.DeleteContext(msg.name)
+		})
+
+	case msgForkContext:
+		return s, s.run(func() error {
+			return s.agent.ForkContext(msg.from, msg.to)
+		})
 
 	case tea.KeyMsg:
 		if !s.focused {
 			break
 		}
 
+		if s.filtering {
+			return s, s.updateFilter(msg)
+		}
+
+		name := ""
+		if row := s.table.SelectedRow(); len(row) > 0 {
+			name = row[0]
+		}
+
 		switch msg.String() {
 		case "down":
 			s.table.MoveDown(1)
 		case "up":
 			s.table.MoveUp(1)
+		case "/":
+			s.filtering = true
+			return s, s.filter.Focus()
+		case "s":
+			s.sortCol = (s.sortCol + 1) % len(contextColumns)
+			s.setRows()
+		case "S":
+			s.sortDesc = !s.sortDesc
+			s.setRows()
+		case "e":
+			s.showEmpty = !s.showEmpty
+			s.setRows()
 		case "enter":
-			row := s.table.SelectedRow()
-			if len(row) > 0 {
-				name := row[0]
+			if name != "" {
 				cmds = append(cmds, func() tea.Msg {
 					return msgSelectContext(name)
 				})
 			}
+		case "r":
+			if name != "" {
+				cmds = append(cmds, showModal(NewInputModal(
+					"Rename "+name+" to:", name,
+					func(to string) tea.Msg {
+						return msgRenameContext{from: name, to: strings.TrimSpace(to)}
+					})))
+			}
+		case "x":
+			if name != "" {
+				cmds = append(cmds, showModal(NewConfirmModal(
+					"Delete "+name+"?",
+					"This deletes the conversation and all of its records, todos, notes, and artifacts.",
+					func(ok bool) tea.Msg {
+						return msgDeleteContext{name: name, ok: ok}
+					})))
+			}
+		case "f":
+			if name != "" {
+				cmds = append(cmds, showModal(NewInputModal(
+					"Fork "+name+" as:", name+"-fork",
+					func(to string) tea.Msg {
+						return msgForkContext{from: name, to: strings.TrimSpace(to)}
+					})))
+			}
 		}
 
 	case WindowSize:
 		if msg.Loc == s.id {
 			s.w = msg.Width
 			s.h = msg.Height
-			s.table.SetHeight(s.h)
+			s.table.SetHeight(s.h - 1)
 			s.table.SetWidth(s.w)
 		}
 	}
@@ -172,6 +349,43 @@ func (s *DatabaseView) Update(msg tea.Msg) (ret tea.Model, cmd tea.Cmd) {
 	return s, cmd
 }
 
+func showModal(modal tea.Model) tea.Cmd {
+	return func() tea.Msg {
+		return msgShowModal{modal: modal}
+	}
+}
+
+// context operations can block behind a running turn, so they happen
+// off the update loop; the table refreshes either way.
+func (s *DatabaseView) run(op func() error) tea.Cmd {
+	return func() tea.Msg {
+		if err := op(); err != nil {
+			return msgViewportLog{Msg: err.Error() + "\n", Style: styleErrorText}
+		}
+		return msgRefreshContexts{}
+	}
+}
+
+// the filter narrows the table as you type; enter keeps it, esc
+// clears it.
+func (s *DatabaseView) updateFilter(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "enter":
+		s.filtering = false
+		s.filter.Blur()
+		return nil
+	case "esc":
+		s.filtering = false
+		s.filter.Blur()
+		s.filter.SetValue("")
+		return s.refreshTable()
+	}
+
+	var cmd tea.Cmd
+	s.filter, cmd = s.filter.Update(msg)
+	return tea.Batch(cmd, s.refreshTable())
+}
+
 func (s *DatabaseView) View() string {
 	if s.w == 0 || s.h == 0 {
 		return ""
@@ -182,7 +396,22 @@ func (s *DatabaseView) View() string {
 		slog.Info("table", "row", row)
 	}
 
+	help := "Enter: open  r: rename  f: fork  x: delete  /: filter  s/S: sort  e: "
+	if s.showEmpty {
+		help += "hide empty"
+	} else {
+		help += "show empty"
+	}
+	if s.filtering || s.filter.Value() != "" {
+		help = s.filter.View()
+	}
+	if s.err != nil {
+		help = styleErrorText.Render("Error: " + s.err.Error())
+	}
+
 	v := lipgloss.NewStyle().
-		Render(s.table.View())
+		Render(lipgloss.JoinVertical(lipgloss.Left,
+			s.table.View(),
+			lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render(help)))
 	return v
 }
@@ -1,19 +1,17 @@
 package main
 
 import (
-	"regexp"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/muesli/reflow/wordwrap"
+
+	"smiley/agent"
 )
 
-type FollowupOption struct {
-	Key         string
-	Description string
-}
+type FollowupOption = agent.Followup
 
 type msgShowFollowupModal []FollowupOption
 type msgFollowupSelected string
@@ -22,50 +20,6 @@ func (mf msgShowFollowupModal) hasFollowups() bool {
 	return len([]FollowupOption(mf)) > 0
 }
 
-func parseFollowups(text string) []FollowupOption {
-	startIdx := strings.Index(text, "<FOLLOWUP>")
-	endIdx := strings.Index(text, "</FOLLOWUP>")
-
-	if startIdx == -1 || endIdx == -1 || endIdx < startIdx {
-		return nil
-	}
-
-	content := text[startIdx+10 : endIdx]
-
-	re := regexp.MustCompile(`\(F[0-9]+\)`)
-	matches := re.FindAllStringIndex(content, -1)
-
-	if len(matches) == 0 {
-		return nil
-	}
-
-	options := []FollowupOption{}
-
-	for i, match := range matches {
-		key := content[match[0]+1 : match[1]-1]
-
-		var description string
-		if i < len(matches)-1 {
-			description = content[match[1]:matches[i+1][0]]
-		} else {
-			description = content[match[1]:]
-		}
-
-		description = strings.TrimSpace(description)
-
-		options = append(options, FollowupOption{
-			Key:         key,
-			Description: description,
-		})
-
-		if len(options) >= 9 {
-			break
-		}
-	}
-
-	return options
-}
-
 type FollowupModal struct {
 	options       []FollowupOption
 	selectedIndex int
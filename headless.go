@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"smiley/agent"
+)
+
+func readStdinPrompt() (string, error) {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return "", fmt.Errorf("stat stdin: %w", err)
+	}
+
+	if fi.Mode()&os.ModeCharDevice != 0 {
+		return "", nil
+	}
+
+	buf, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("read stdin: %w", err)
+	}
+
+	return strings.TrimSpace(string(buf)), nil
+}
+
+func jsonEventWriter(ag *agent.Agent, w io.Writer) func(agent.Message) {
+	enc := json.NewEncoder(w)
+
+	return func(msg agent.Message) {
+		ev, ok := agent.NewEvent(ag.ContextName(), msg)
+		if !ok {
+			return
+		}
+
+		if err := enc.Encode(ev); err != nil {
+			fmt.Fprintf(os.Stderr, "write event: %v\n", err)
+		}
+	}
+}
+
+func textEventWriter(msg agent.Message) {
+	switch msg := msg.(type) {
+	case agent.ToolCallMsg:
+		if *optLogTools {
+			fmt.Fprintln(os.Stderr, msg.Msg)
+		}
+	case agent.ErrorMsg:
+		fmt.Fprint(os.Stderr, msg.Msg)
+	case agent.PressureMsg:
+		fmt.Fprintln(os.Stderr, msg.Msg)
+	case agent.CancelledMsg:
+		fmt.Fprintln(os.Stderr, "cancelled")
+	}
+}
+
+func runHeadless(ag *agent.Agent, prompt string, jsonEvents bool) int {
+	if prompt == "" {
+		p, err := readStdinPrompt()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		prompt = p
+	}
+
+	if prompt == "" {
+		fmt.Fprintln(os.Stderr, "no prompt: pass one as arguments or on stdin")
+		return 2
+	}
+
+	ag.OnEvent = textEventWriter
+	if jsonEvents {
+		ag.OnEvent = jsonEventWriter(ag, os.Stdout)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer signal.Stop(sigs)
+
+	go func() {
+		for range sigs {
+			ag.Cancel()
+		}
+	}()
+
+	response, err := ag.RunPrompt(prompt)
+	if err != nil {
+		return 1
+	}
+
+	if !jsonEvents {
+		fmt.Println(response)
+	}
+	return 0
+}
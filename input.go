@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type InputModal struct {
+	title    string
+	input    textinput.Model
+	width    int
+	onSubmit func(string) tea.Msg
+}
+
+func NewInputModal(title, value string, onSubmit func(string) tea.Msg) *InputModal {
+	input := textinput.New()
+	input.SetValue(value)
+	input.CursorEnd()
+	input.Width = 50
+	input.Focus()
+
+	return &InputModal{
+		title:    title,
+		input:    input,
+		width:    60,
+		onSubmit: onSubmit,
+	}
+}
+
+func (m *InputModal) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m *InputModal) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if km, ok := msg.(tea.KeyMsg); ok {
+		switch km.String() {
+		case "enter":
+			value := m.input.Value()
+			return m, tea.Sequence(
+				func() tea.Msg {
+					return msgCloseModal{}
+				},
+				func() tea.Msg {
+					return m.onSubmit(value)
+				},
+			)
+		case "esc":
+			return m, func() tea.Msg {
+				return msgCloseModal{}
+			}
+		}
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m *InputModal) View() string {
+	header := lipgloss.NewStyle().
+		Width(m.width - 4).
+		Foreground(lipgloss.Color("230")).
+		Render(m.title)
+
+	footer := lipgloss.NewStyle().
+		Width(m.width - 4).
+		Foreground(lipgloss.Color("240")).
+		Render("Enter: ok  Esc: cancel")
+
+	modalStyle := lipgloss.NewStyle().
+		Width(m.width).
+		Padding(1, 2).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("62")).
+		Background(lipgloss.Color("235")).
+		Foreground(lipgloss.Color("230"))
+
+	return modalStyle.Render(lipgloss.JoinVertical(
+		lipgloss.Left,
+		header,
+		"",
+		m.input.View(),
+		"",
+		footer,
+	))
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/wordwrap"
+	"github.com/superfly/contextwindow"
+
+	"smiley/agent"
+)
+
+type msgInspectorRecords struct {
+	records []contextwindow.Record
+	models  map[int64]string
+}
+type msgInspectorDelete struct {
+	id int64
+	ok bool
+}
+
+type InspectorView struct {
+	id      string
+	agent   *agent.Agent
+	w, h    int
+	records []contextwindow.Record
+	models  map[int64]string
+	table   table.Model
+	focused bool
+}
+
+func NewInspectorView(id string, ag *agent.Agent) *InspectorView {
+	cols := []table.Column{
+		{Title: "#", Width: 5},
+		{Title: "Source", Width: 10},
+		{Title: "Live", Width: 5},
+		{Title: "Bytes", Width: 8},
+		{Title: "Tokens", Width: 8},
+		{Title: "Model", Width: 24},
+		{Title: "Content", Width: 40},
+	}
+
+	return &InspectorView{
+		id:    id,
+		agent: ag,
+		table: table.New(
+			table.WithFocused(true),
+			table.WithColumns(cols),
+		),
+	}
+}
+
+func (s *InspectorView) refresh() tea.Msg {
+	records, err := s.agent.Records()
+	if err != nil {
+		return msgViewportLog{Msg: "inspector: " + err.Error() + "\n", Style: styleErrorText}
+	}
+
+	models, err := s.agent.ResponseModels()
+	if err != nil {
+		return msgViewportLog{Msg: "inspector: " + err.Error() + "\n", Style: styleErrorText}
+	}
+
+	return msgInspectorRecords{records: records, models: models}
+}
+
+func (s *InspectorView) selected() (contextwindow.Record, bool) {
+	i := s.table.Cursor()
+	if i < 0 || i >= len(s.records) {
+		return contextwindow.Record{}, false
+	}
+
+	return s.records[i], true
+}
+
+func (s *InspectorView) setLive(live bool) tea.Cmd {
+	r, ok := s.selected()
+	if !ok || r.Live == live {
+		return nil
+	}
+
+	return func() tea.Msg {
+		if err := s.agent.SetRecordsLive([]int64{r.ID}, live); err != nil {
+			return msgViewportLog{Msg: "inspector: " + err.Error() + "\n", Style: styleErrorText}
+		}
+		return s.refresh()
+	}
+}
+
+func (s *InspectorView) confirmDelete() tea.Cmd {
+	r, ok := s.selected()
+	if !ok {
+		return nil
+	}
+
+	return func() tea.Msg {
+		return msgShowModal{
+			modal: NewConfirmModal(
+				fmt.Sprintf("Delete record %d?", s.table.Cursor()),
+				"This removes it from the database for good; "+
+					"marking it dead (d) keeps it around.",
+				func(ok bool) tea.Msg {
+					return msgInspectorDelete{id: r.ID, ok: ok}
+				}),
+		}
+	}
+}
+
+func (s *InspectorView) setRows() {
+	rows := []table.Row{}
+
+	for i, r := range s.records {
+		live := "yes"
+		if !r.Live {
+			live = "no"
+		}
+
+		rows = append(rows, table.Row{
+			strconv.Itoa(i),
+			recordKind(r.Source),
+			live,
+			strconv.Itoa(len(r.Content)),
+			strconv.Itoa(r.EstTokens),
+			s.models[r.ID],
+			oneLine(r.Content),
+		})
+	}
+
+	s.table.SetRows(rows)
+}
+
+func (s *InspectorView) Init() tea.Cmd {
+	return s.refresh
+}
+
+func (s *InspectorView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case msgFocusChanged:
+		s.focused = (msg.region == "top")
+
+	case msgTranscriptRefresh:
+		return s, s.refresh
+
+	case msgInspectorRecords:
+		s.records = msg.records
+		s.models = msg.models
+		s.setRows()
+
+	case msgInspectorDelete:
+		if !msg.ok {
+			break
+		}
+		return s, func() tea.Msg {
+			if err := s.agent.DeleteRecords([]int64{msg.id}); err != nil {
+				return msgViewportLog{Msg: "inspector: " + err.Error() + "\n", Style: styleErrorText}
+			}
+			return s.refresh()
+		}
+
+	case tea.KeyMsg:
+		if !s.focused {
+			break
+		}
+
+		switch msg.String() {
+		case "down":
+			s.table.MoveDown(1)
+		case "up":
+			s.table.MoveUp(1)
+		case "enter":
+			if r, ok := s.selected(); ok {
+				title := fmt.Sprintf("Record %d (%s, %d bytes)",
+					s.table.Cursor(), recordKind(r.Source), len(r.Content))
+				return s, func() tea.Msg {
+					return msgShowModal{modal: NewRecordModal(title, r.Content, s.w, s.h)}
+				}
+			}
+		case "l":
+			return s, s.setLive(true)
+		case "d":
+			return s, s.setLive(false)
+		case "x":
+			return s, s.confirmDelete()
+		}
+
+	case WindowSize:
+		if msg.Loc == s.id {
+			s.w = msg.Width
+			s.h = msg.Height
+			s.table.SetHeight(s.h)
+			s.table.SetWidth(s.w)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *InspectorView) View() string {
+	if s.w == 0 || s.h == 0 {
+		return ""
+	}
+
+	return s.table.View()
+}
+
+type RecordModal struct {
+	title string
+	vm    viewport.Model
+}
+
+func NewRecordModal(title, content string, w, h int) *RecordModal {
+	w, h = max(w-8, 40), max(h-4, 10)
+
+	vm := viewport.New(w, h)
+	vm.SetContent(wordwrap.String(content, w))
+
+	return &RecordModal{title: title, vm: vm}
+}
+
+func (m *RecordModal) Init() tea.Cmd {
+	return nil
+}
+
+func (m *RecordModal) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	km, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+
+	switch km.String() {
+	case "enter", "esc", "q":
+		return m, func() tea.Msg {
+			return msgCloseModal{}
+		}
+	}
+
+	var cmd tea.Cmd
+	m.vm, cmd = m.vm.Update(msg)
+	return m, cmd
+}
+
+func (m *RecordModal) View() string {
+	header := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("230")).
+		Render(m.title)
+
+	footer := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("240")).
+		Render(fmt.Sprintf("%3.0f%%  ↑/↓ PgUp/PgDn: scroll  Enter/Esc: close",
+			m.vm.ScrollPercent()*100))
+
+	modalStyle := lipgloss.NewStyle().
+		Padding(0, 1).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("62")).
+		Background(lipgloss.Color("235")).
+		Foreground(lipgloss.Color("230"))
+
+	return modalStyle.Render(lipgloss.JoinVertical(
+		lipgloss.Left,
+		header,
+		m.vm.View(),
+		footer,
+	))
+}
@@ -3,21 +3,27 @@ package main
 import "github.com/charmbracelet/bubbles/key"
 
 type KeyMap struct {
-	Send     key.Binding
-	History  key.Binding
-	Log      key.Binding
-	Quit     key.Binding
-	Switch   key.Binding
-	Modal    key.Binding
-	Followup key.Binding
+	Send       key.Binding
+	History    key.Binding
+	Log        key.Binding
+	Transcript key.Binding
+	Inspector  key.Binding
+	Quit       key.Binding
+	Switch     key.Binding
+	Modal      key.Binding
+	Followup   key.Binding
+	Cancel     key.Binding
 }
 
 var CurrentKeyMap = KeyMap{
-	Send:     key.NewBinding(key.WithKeys("tab", "ctrl+j")),
-	History:  key.NewBinding(key.WithKeys("ctrl+h")),
-	Quit:     key.NewBinding(key.WithKeys("ctrl+c")),
-	Log:      key.NewBinding(key.WithKeys("ctrl+l")),
-	Switch:   key.NewBinding(key.WithKeys("shift+tab")),
-	Modal:    key.NewBinding(key.WithKeys("ctrl+k")),
-	Followup: key.NewBinding(key.WithKeys("ctrl+n")),
+	Send:       key.NewBinding(key.WithKeys("tab", "ctrl+j")),
+	History:    key.NewBinding(key.WithKeys("ctrl+h")),
+	Quit:       key.NewBinding(key.WithKeys("ctrl+c")),
+	Log:        key.NewBinding(key.WithKeys("ctrl+l")),
+	Transcript: key.NewBinding(key.WithKeys("ctrl+t")),
+	Inspector:  key.NewBinding(key.WithKeys("ctrl+o")),
+	Switch:     key.NewBinding(key.WithKeys("shift+tab")),
+	Modal:      key.NewBinding(key.WithKeys("ctrl+k")),
+	Followup:   key.NewBinding(key.WithKeys("ctrl+n")),
+	Cancel:     key.NewBinding(key.WithKeys("esc")),
 }
@@ -45,25 +45,51 @@ func init() {
 }
 
 func main() {
+	if run, ok := subcommand(os.Args[1:]); ok {
+		os.Exit(run(os.Args[2:]))
+	}
+
 	var (
+		configPath    = flag.String("config", "", "Path to config.toml (default $XDG_CONFIG_HOME/smiley/config.toml or ~/.ctxagent/config.toml)")
+		profile       = flag.String("profile", "", "Named [profile.<name>] from config.toml to apply")
 		systemMd      = flag.String("system", "", "Path to system.md")
 		toolConfig    = flag.String("tools", "", "Path to tools.toml")
 		contextDb     = flag.String("db", "", "Path to contextwindow.db")
 		contextName   = flag.String("name", "", "Optional conversation name")
 		maxTokens     = flag.Int("maxtokens", 60_000, "Maximum tokens before compacting")
 		forkFrom      = flag.String("fork", "", "Conversation to fork")
-		modelProvider = flag.String("model", "openai", "LLM provider: openai or claude")
+		modelProvider = flag.String("model", "openai", "LLM provider: openai, claude, openai-compatible, or fake")
 		modelName     = flag.String("model-name", "", "Specific model name (e.g., claude-haiku-4-5, claude-sonnet-4-5, gpt-5-mini-2025-08-07)")
+		baseURL       = flag.String("base-url", "", "API endpoint for -model (e.g. http://localhost:11434/v1 for Ollama)")
+		printMode     = flag.Bool("print", false, "Run the prompt (from args or stdin) non-interactively and print the response")
+		jsonMode      = flag.Bool("json", false, "Like -print, but write every agent event to stdout as JSON lines")
+		approve       = flag.String("approve", "deny", "Headless policy for confirm=true tools: deny, allow, or a comma-separated list of tool names to allow")
+		pressureAt    = flag.Float64("pressure", 0.8, "Fraction of -maxtokens at which to apply -pressure-strategy")
+		pressure      = flag.String("pressure-strategy", "", "What to do when context usage crosses -pressure: drop-tools, summarize, or warn (default: nothing)")
 	)
 
 	flag.Usage = func() {
-		fmt.Println("smiley [options]")
+		fmt.Println("smiley [options] [prompt]")
+		fmt.Println("smiley -search [options] <query>")
+		fmt.Println("smiley -export-fixture [options] <conversation>")
+		fmt.Println("smiley -replay [options] <fixture.yaml>")
 		flag.PrintDefaults()
 		os.Exit(0)
 	}
 
 	flag.Parse()
 
+	// flags from the command line beat a conversation's saved settings;
+	// the config file and the defaults don't.
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if err := applyConfig(flag.CommandLine, *configPath, *profile, true); err != nil {
+		eprintf("%v", err)
+	}
+
 	prompt := strings.TrimSpace(strings.Join(flag.Args(), " "))
 
 	cfgdir, err := agent.EnsureCtxAgentDir()
@@ -71,11 +97,44 @@ func main() {
 		eprintf("Find ~/.ctxagent: %v", err)
 	}
 
+	path := filepath.Join(cfgdir, "contextwindow.db")
+	if *contextDb != "" {
+		path = *contextDb
+	}
+	db, err := contextwindow.NewContextDB(path)
+	if err != nil {
+		eprintf("Open %s: %v", path, err)
+	}
+
+	if err := agent.InitializeSchema(db); err != nil {
+		eprintf("Initialize %s: %v", path, err)
+	}
+
+	// a fork starts out with the settings of the conversation it came from.
+	resumeFrom := *contextName
+	if *forkFrom != "" {
+		resumeFrom = *forkFrom
+	}
+
+	var (
+		saved   agent.ContextSettings
+		resumed bool
+	)
+	if resumeFrom != "" {
+		saved, resumed, err = agent.LoadContextSettings(db, resumeFrom)
+		if err != nil {
+			eprintf("%v", err)
+		}
+	}
+
 	toolConfigPath := filepath.Join(cfgdir, "tools.toml")
 
 	if *toolConfig != "" {
 		toolConfigPath = *toolConfig
 	}
+	if resumed && !explicit["tools"] {
+		toolConfigPath = saved.ToolsPath
+	}
 
 	systemPrompt := defaultSystemPrompt
 	systemPromptPath := filepath.Join(cfgdir, "system.md")
@@ -90,40 +149,25 @@ func main() {
 	} else {
 		systemPrompt = string(pbuf)
 	}
-
-	path := filepath.Join(cfgdir, "contextwindow.db")
-	if *contextDb != "" {
-		path = *contextDb
+	if resumed && !explicit["system"] {
+		systemPrompt = saved.SystemPrompt
 	}
-	db, err := contextwindow.NewContextDB(path)
-	if err != nil {
-		eprintf("Open %s: %v", path, err)
+
+	if resumed && !explicit["maxtokens"] && saved.MaxTokens > 0 {
+		*maxTokens = saved.MaxTokens
 	}
 
-	var model contextwindow.Model
-	switch *modelProvider {
-	case "openai":
-		defaultModel := contextwindow.ResponsesModelGPT5Mini
-		if *modelName != "" {
-			model, err = contextwindow.NewOpenAIResponsesModel(*modelName)
-		} else {
-			model, err = contextwindow.NewOpenAIResponsesModel(defaultModel)
-		}
-		if err != nil {
-			eprintf("Connect to OpenAI: %v", err)
-		}
-	case "claude":
-		defaultModel := contextwindow.ModelClaudeHaiku45
-		selectedModel := defaultModel
-		if *modelName != "" {
-			selectedModel = *modelName
-		}
-		model, err = contextwindow.NewClaudeModel(selectedModel)
-		if err != nil {
-			eprintf("Connect to Claude: %v", err)
+	// the endpoint goes with the model it was saved with.
+	if resumed && !explicit["model"] && !explicit["model-name"] && saved.Model != "" {
+		*modelProvider, *modelName, _ = strings.Cut(saved.Model, "/")
+		if !explicit["base-url"] {
+			*baseURL = saved.BaseURL
 		}
-	default:
-		eprintf("Unknown model provider: %s (use 'openai' or 'claude')", *modelProvider)
+	}
+
+	model, modelUsed, err := openModel(*modelProvider, *modelName, *baseURL)
+	if err != nil {
+		eprintf("%v", err)
 	}
 
 	var ag *agent.Agent
@@ -137,26 +181,60 @@ func main() {
 		eprintf("Create agent: %v", err)
 	}
 
-	ag.RegisterBuiltinTool("todo", &agent.Todo{})
-	ag.RegisterBuiltinTool("review", &agent.Review{})
-	ag.RegisterBuiltinTool("lobotomize", &agent.Lobotomize{})
+	ag.OpenModel = openModel
+
+	registerBuiltins(ag)
 	ag.SetSystemPrompt(systemPrompt)
 	ag.SetMaxTokens(*maxTokens)
+	ag.SetModelName(modelUsed)
+	ag.SetBaseURL(*baseURL)
+
+	strategy, err := agent.ParsePressureStrategy(*pressure)
+	if err != nil {
+		eprintf("-pressure-strategy: %v", err)
+	}
+	ag.SetPressurePolicy(agent.PressurePolicy{
+		Threshold: *pressureAt,
+		Strategy:  strategy,
+	})
+
+	if toolConfigPath != "" {
+		if err := ag.LoadTools(toolConfigPath); err != nil {
+			// Only error if explicit tool config was provided
+			if *toolConfig != "" {
+				eprintf("Loading tool definitions from %s: %v", toolConfigPath, err)
+			}
+		}
+	}
 
-	if err := ag.LoadTools(toolConfigPath); err != nil {
-		// Only error if explicit tool config was provided
-		if *toolConfig != "" {
-			eprintf("Loading tool definitions from %s: %v", toolConfigPath, err)
+	var overrides string
+	if resumed {
+		if changes := ag.Settings().Changes(saved); len(changes) > 0 {
+			overrides = fmt.Sprintf("warning: %s was saved with different settings; now using %s\n",
+				resumeFrom, strings.Join(changes, ", "))
 		}
 	}
 
-	m := newRootWindow("", ag.GetContextWindow(), prompt, *contextName)
+	if err := ag.SaveSettings(); err != nil {
+		eprintf("%v", err)
+	}
+
+	if *printMode || *jsonMode {
+		fmt.Fprint(os.Stderr, overrides)
+		ag.Approve = agent.ApprovalPolicy(*approve)
+		os.Exit(runHeadless(ag, prompt, *jsonMode))
+	}
+
+	m := newRootWindow(overrides, ag, prompt, *contextName)
 	m.db = db
 
 	controllers := Controllers{}
 	controllers = append(controllers, &TextAreaInput{})
 	controllers = append(controllers, &SlashCommandController{
-		cw: ag.GetContextWindow(),
+		agent: ag,
+		cw:    ag.GetContextWindow(),
+		todos: ag.Todos(),
+		notes: ag.Notes(),
 	})
 
 	tuiAgent := &TUIAgentController{
@@ -168,6 +246,8 @@ func main() {
 	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion())
 	m.p = p
 
+	ag.Approve = tuiApprover(p)
+
 	ag.OnEvent = func(msg agent.Message) {
 		switch msg := msg.(type) {
 		case agent.ToolCallMsg:
@@ -180,10 +260,19 @@ func main() {
 			})
 		case agent.ModelResponseMsg:
 			p.Send(msgModelResponse(msg.Response))
+		case agent.ModelDeltaMsg:
+			p.Send(msgViewportDelta{
+				Msg:   msg.Delta,
+				Style: styleResponseText,
+			})
 		case agent.TokenUsageMsg:
 			p.Send(msgTokenUsage(msg.Usage))
 		case agent.WorkingMsg:
 			p.Send(msgWorking(msg.Working))
+		case agent.CancelledMsg:
+			p.Send(msgCancelled{})
+		case agent.PressureMsg:
+			p.Send(msgPressure(msg))
 		case agent.ErrorMsg:
 			p.Send(msgViewportLog{
 				Msg:   msg.Msg,
@@ -198,6 +287,15 @@ func main() {
 
 }
 
+func registerBuiltins(ag *agent.Agent) {
+	ag.RegisterBuiltinTool("todo", agent.NewTodo(ag.Todos()))
+	ag.RegisterBuiltinTool("review", &agent.Review{})
+	ag.RegisterBuiltinTool("lobotomize", &agent.Lobotomize{})
+	ag.RegisterBuiltinTool("artifact", agent.NewArtifact(ag.Artifacts()))
+	ag.RegisterBuiltinTool("notes", agent.NewNotes(ag.Notes()))
+	ag.RegisterBuiltinTool("compact", agent.NewCompact(ag))
+}
+
 func round(tot, pct int) int {
 	if tot <= 0 || pct <= 0 {
 		return 0
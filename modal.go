@@ -3,17 +3,20 @@ package main
 import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/wordwrap"
 )
 
 type Modal struct {
-	width  int
-	height int
+	title string
+	body  string
+	width int
 }
 
-func NewModal() *Modal {
+func NewModal(title, body string) *Modal {
 	return &Modal{
-		width:  50,
-		height: 10,
+		title: title,
+		body:  body,
+		width: 60,
 	}
 }
 
@@ -22,30 +25,53 @@ func (m *Modal) Init() tea.Cmd {
 }
 
 func (m *Modal) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	km, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+
+	switch km.String() {
+	case "enter", "esc", "q":
+		return m, func() tea.Msg {
+			return msgCloseModal{}
+		}
+	}
+
 	return m, nil
 }
 
 func (m *Modal) View() string {
-	content := `Hello World!
+	header := lipgloss.NewStyle().
+		Width(m.width - 4).
+		Foreground(lipgloss.Color("230")).
+		Render(m.title)
 
-This is a test modal window.
-It has multiple lines of static content.
+	body := lipgloss.NewStyle().
+		Width(m.width - 4).
+		Foreground(lipgloss.Color("#dd9f6b")).
+		Render(wordwrap.String(m.body, m.width-6))
 
-Press ctrl+k to dismiss this modal.
+	footer := lipgloss.NewStyle().
+		Width(m.width - 4).
+		Foreground(lipgloss.Color("240")).
+		Render("Enter/Esc: dismiss")
 
-This is just a proof of concept
-to demonstrate that modals work
-in this codebase.`
+	modalContent := lipgloss.JoinVertical(
+		lipgloss.Left,
+		header,
+		"",
+		body,
+		"",
+		footer,
+	)
 
 	modalStyle := lipgloss.NewStyle().
 		Width(m.width).
-		Height(m.height).
 		Padding(1, 2).
 		Border(lipgloss.RoundedBorder()).
 		BorderForeground(lipgloss.Color("62")).
 		Background(lipgloss.Color("235")).
-		Foreground(lipgloss.Color("230")).
-		Align(lipgloss.Left, lipgloss.Top)
+		Foreground(lipgloss.Color("230"))
 
-	return modalStyle.Render(content)
+	return modalStyle.Render(modalContent)
 }
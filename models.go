@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/superfly/contextwindow"
+
+	"smiley/agent"
+)
+
+type modelChoice struct {
+	provider string
+	name     string
+}
+
+func (c modelChoice) String() string {
+	return c.provider + "/" + c.name
+}
+
+// what the /model picker offers; /model takes any name the provider
+// accepts.
+var knownModels = []modelChoice{
+	{"openai", contextwindow.ResponsesModelGPT5Mini},
+	{"openai", contextwindow.ResponsesModelGPT5},
+	{"claude", agent.ClaudeHaiku45},
+	{"claude", agent.ClaudeSonnet45},
+}
+
+// the models read their endpoints from the environment, so a base URL
+// just sets the right variable; openai-compatible reads OPENAI_BASE_URL
+// too.
+func baseURLEnv(provider string) string {
+	if provider == "claude" {
+		return "ANTHROPIC_BASE_URL"
+	}
+	return "OPENAI_BASE_URL"
+}
+
+// what the environment said before we started setting it, for models
+// opened without a base URL.
+var envBaseURLs = map[string]string{
+	"OPENAI_BASE_URL":    os.Getenv("OPENAI_BASE_URL"),
+	"ANTHROPIC_BASE_URL": os.Getenv("ANTHROPIC_BASE_URL"),
+}
+
+func setBaseURL(provider, url string) {
+	env := baseURLEnv(provider)
+	if url == "" {
+		url = envBaseURLs[env]
+	}
+
+	if url == "" {
+		os.Unsetenv(env)
+		return
+	}
+	os.Setenv(env, url)
+}
+
+func defaultModel(provider string) string {
+	for _, c := range knownModels {
+		if c.provider == provider {
+			return c.name
+		}
+	}
+	return ""
+}
+
+// an empty name picks the provider's default, and an empty baseURL the
+// provider's usual endpoint. returns the model and the "provider/name"
+// it should be recorded under.
+func openModel(provider, name, baseURL string) (contextwindow.Model, string, error) {
+	if name == "" {
+		name = defaultModel(provider)
+	}
+
+	setBaseURL(provider, baseURL)
+
+	var (
+		model contextwindow.Model
+		err   error
+	)
+
+	switch provider {
+	case "openai":
+		model, err = agent.NewResponsesModel(os.Getenv("OPENAI_BASE_URL"),
+			os.Getenv("OPENAI_API_KEY"), name)
+		if err != nil {
+			return nil, "", fmt.Errorf("connect to OpenAI: %w", err)
+		}
+	case "claude":
+		model, err = agent.NewClaudeModel(os.Getenv("ANTHROPIC_BASE_URL"),
+			os.Getenv("ANTHROPIC_API_KEY"), name)
+		if err != nil {
+			return nil, "", fmt.Errorf("connect to Claude: %w", err)
+		}
+	case "openai-compatible":
+		model, err = agent.NewChatModel(os.Getenv("OPENAI_BASE_URL"),
+			os.Getenv("OPENAI_API_KEY"), name)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w (openai-compatible needs -base-url and -model-name)", err)
+		}
+	case "fake":
+		model, err = agent.LoadFakeModel(name)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w (fake needs -model-name fixture.yaml)", err)
+		}
+	default:
+		return nil, "", fmt.Errorf("unknown model provider: %s (use 'openai', 'claude', 'openai-compatible', or 'fake')", provider)
+	}
+
+	return model, modelChoice{provider, name}.String(), nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/truncate"
+)
+
+type PickerItem struct {
+	Title  string
+	Detail string
+	Value  any
+}
+
+type PickerModal struct {
+	title  string
+	items  []PickerItem
+	cursor int
+	top    int
+	width  int
+	height int
+	onPick func(PickerItem) tea.Msg
+}
+
+func NewPickerModal(title string, items []PickerItem, onPick func(PickerItem) tea.Msg) *PickerModal {
+	return &PickerModal{
+		title:  title,
+		items:  items,
+		width:  80,
+		height: 10,
+		onPick: onPick,
+	}
+}
+
+func (m *PickerModal) Init() tea.Cmd {
+	return nil
+}
+
+func (m *PickerModal) move(n int) {
+	m.cursor = max(0, min(m.cursor+n, len(m.items)-1))
+
+	if m.cursor < m.top {
+		m.top = m.cursor
+	}
+	if m.cursor >= m.top+m.height {
+		m.top = m.cursor - m.height + 1
+	}
+}
+
+func (m *PickerModal) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	km, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+
+	switch km.String() {
+	case "up", "k":
+		m.move(-1)
+	case "down", "j":
+		m.move(1)
+	case "pgup":
+		m.move(-m.height)
+	case "pgdown":
+		m.move(m.height)
+	case "enter":
+		if len(m.items) == 0 {
+			break
+		}
+		item := m.items[m.cursor]
+		return m, tea.Sequence(
+			func() tea.Msg {
+				return msgCloseModal{}
+			},
+			func() tea.Msg {
+				return m.onPick(item)
+			},
+		)
+	case "esc", "q":
+		return m, func() tea.Msg {
+			return msgCloseModal{}
+		}
+	}
+
+	return m, nil
+}
+
+func (m *PickerModal) View() string {
+	inner := m.width - 4
+
+	header := lipgloss.NewStyle().
+		Width(inner).
+		Foreground(lipgloss.Color("230")).
+		Render(m.title)
+
+	titleStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("230"))
+	detailStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("245"))
+	cursorStyle := lipgloss.NewStyle().Background(lipgloss.Color("62"))
+
+	lines := []string{header, ""}
+
+	if len(m.items) == 0 {
+		lines = append(lines, detailStyle.Render("(nothing found)"))
+	}
+
+	for i := m.top; i < len(m.items) && i < m.top+m.height; i++ {
+		item := m.items[i]
+
+		title := titleStyle.Render(truncate.StringWithTail(item.Title, uint(inner), "…"))
+		if i == m.cursor {
+			title = cursorStyle.Render(truncate.StringWithTail(item.Title, uint(inner), "…"))
+		}
+		lines = append(lines, title)
+
+		if item.Detail != "" {
+			lines = append(lines,
+				detailStyle.Render("  "+truncate.StringWithTail(item.Detail, uint(inner-2), "…")))
+		}
+	}
+
+	footer := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("240")).
+		Render("↑/↓: move  Enter: pick  Esc: close")
+	lines = append(lines, "", footer)
+
+	modalStyle := lipgloss.NewStyle().
+		Width(m.width).
+		Padding(1, 2).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("62")).
+		Background(lipgloss.Color("235")).
+		Foreground(lipgloss.Color("230"))
+
+	return modalStyle.Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
@@ -3,18 +3,22 @@ package main
 import (
 	"database/sql"
 	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	overlay "github.com/rmhubbert/bubbletea-overlay"
-	"github.com/superfly/contextwindow"
+
+	"smiley/agent"
 )
 
 const (
 	screenLog = iota
 	screenHistory
+	screenTranscript
+	screenInspector
 )
 
 // subwindow height
@@ -32,6 +36,8 @@ type rootWindow struct {
 	state          int
 	top            Box
 	history        *DatabaseView
+	transcript     *TranscriptView
+	inspector      *InspectorView
 	log            *Viewport
 	controllers    Controller
 	w, h, th, bh   int // top height, bottom height
@@ -42,6 +48,9 @@ type rootWindow struct {
 	overlay             *overlay.Model
 	lastFollowupOptions []FollowupOption
 
+	// modals that turned up while a confirmation was waiting.
+	queuedModals []tea.Model
+
 	db *sql.DB
 }
 
@@ -53,7 +62,7 @@ type msgFocusChanged struct {
 
 func newRootWindow(
 	content string,
-	cw *contextwindow.ContextWindow,
+	ag *agent.Agent,
 	initialPrompt string,
 	contextName string,
 ) rootWindow {
@@ -64,7 +73,9 @@ func newRootWindow(
 
 	m.status = NewStatus()
 
-	m.history = NewDatabaseView("top-inner", cw)
+	m.history = NewDatabaseView("top-inner", ag)
+	m.transcript = NewTranscriptView("top-inner", ag)
+	m.inspector = NewInspectorView("top-inner", ag)
 	m.log = NewViewport("top-inner", content)
 
 	box := NewBox("top", "top-inner", false, false, true, false)
@@ -76,7 +87,7 @@ func newRootWindow(
 	m.bottom = input
 	m.focus = "bottom"
 
-	m.modal = NewModal()
+	m.modal = NewModal("", "")
 	m.modalVisible = false
 
 	return m
@@ -165,7 +176,22 @@ func (m rootWindow) switchFocus() (tea.Model, tea.Cmd) {
 }
 
 func (m *rootWindow) installModal() {
-	m.modal = NewFollowupModal(m.lastFollowupOptions)
+	if m.awaitingAnswer() {
+		return
+	}
+	m.showModal(NewFollowupModal(m.lastFollowupOptions))
+}
+
+// a confirmation (a tool approval holds up the whole turn) goes away
+// only when it's answered: it can't be hidden, and other modals wait
+// behind it.
+func (m *rootWindow) awaitingAnswer() bool {
+	_, ok := m.modal.(*ConfirmModal)
+	return ok && m.modalVisible
+}
+
+func (m *rootWindow) showModal(modal tea.Model) {
+	m.modal = modal
 	m.overlay = overlay.New(
 		m.modal,
 		nil,
@@ -183,7 +209,7 @@ func (m rootWindow) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	)
 
 	if km, ok := msg.(tea.KeyMsg); ok {
-		if key.Matches(km, CurrentKeyMap.Modal) {
+		if key.Matches(km, CurrentKeyMap.Modal) && !m.awaitingAnswer() {
 			m.modalVisible = !m.modalVisible
 			return m, nil
 		}
@@ -197,6 +223,12 @@ func (m rootWindow) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case screenLog:
 			m.top.Inner = m.log
 			m.state = screenLog
+		case screenTranscript:
+			m.top.Inner = m.transcript
+			m.state = screenTranscript
+		case screenInspector:
+			m.top.Inner = m.inspector
+			m.state = screenInspector
 		default:
 			panic("bad state")
 		}
@@ -230,6 +262,29 @@ func (m rootWindow) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		//return m, nil
 
+	case msgShowModal:
+		if m.awaitingAnswer() {
+			m.queuedModals = append(m.queuedModals, msg.modal)
+			return m, nil
+		}
+		m.showModal(msg.modal)
+		return m, nil
+
+	case msgCloseModal:
+		if msg.modal != nil && msg.modal != m.modal {
+			m.queuedModals = slices.DeleteFunc(m.queuedModals, func(q tea.Model) bool {
+				return q == msg.modal
+			})
+			return m, nil
+		}
+
+		m.modalVisible = false
+		if len(m.queuedModals) > 0 {
+			m.showModal(m.queuedModals[0])
+			m.queuedModals = m.queuedModals[1:]
+		}
+		return m, nil
+
 	case msgSwitchScreen:
 		return swtch(int(msg))
 
@@ -256,6 +311,16 @@ func (m rootWindow) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return swtch(screenHistory)
 			case key.Matches(msg, CurrentKeyMap.Log):
 				return swtch(screenLog)
+			case key.Matches(msg, CurrentKeyMap.Transcript):
+				model, cmd := swtch(screenTranscript)
+				return model, tea.Batch(cmd, m.transcript.refresh)
+			case key.Matches(msg, CurrentKeyMap.Inspector):
+				model, cmd := swtch(screenInspector)
+				return model, tea.Batch(cmd, m.inspector.refresh)
+			case key.Matches(msg, CurrentKeyMap.Cancel) && !m.history.filtering:
+				return m, func() tea.Msg {
+					return msgCancelTurn{}
+				}
 			}
 		}
 
@@ -278,9 +343,24 @@ func (m rootWindow) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.log = rm.(*Viewport)
 		cmds = append(cmds, cmd)
 
-		rm, cmd = m.history.Update(msg)
-		m.history = rm.(*DatabaseView)
-		cmds = append(cmds, cmd)
+		// these act on single keys, so only the visible one gets them
+		if !keyb || m.state == screenHistory {
+			rm, cmd = m.history.Update(msg)
+			m.history = rm.(*DatabaseView)
+			cmds = append(cmds, cmd)
+		}
+
+		if !keyb || m.state == screenTranscript {
+			rm, cmd = m.transcript.Update(msg)
+			m.transcript = rm.(*TranscriptView)
+			cmds = append(cmds, cmd)
+		}
+
+		if !keyb || m.state == screenInspector {
+			rm, cmd = m.inspector.Update(msg)
+			m.inspector = rm.(*InspectorView)
+			cmds = append(cmds, cmd)
+		}
 
 		m.status, cmd = m.status.Update(msg)
 		cmds = append(cmds, cmd)
@@ -1,17 +1,24 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/superfly/contextwindow"
+
+	"smiley/agent"
 )
 
 type SlashCommandController struct {
-	cw *contextwindow.ContextWindow
+	agent *agent.Agent
+	cw    *contextwindow.ContextWindow
+	todos *agent.TodoStore
+	notes *agent.NoteStore
 }
 
 func (t *SlashCommandController) Update(msg tea.Msg) (Controller, tea.Cmd) {
@@ -21,6 +28,18 @@ func (t *SlashCommandController) Update(msg tea.Msg) (Controller, tea.Cmd) {
 			"/help":    t.slashHelp,
 			"/dump":    t.slashDump,
 			"/summary": t.slashSummary,
+			"/todo":    t.slashTodo,
+			"/notes":   t.slashNotes,
+			"/revive":  t.slashRevive,
+		}
+
+		switch strings.ToLower(msg[0]) {
+		case "/compact":
+			return t, t.slashCompact([]string(msg))
+		case "/search":
+			return t, t.slashSearch([]string(msg))
+		case "/model":
+			return t, t.slashModel([]string(msg))
 		}
 
 		if fn, ok := slashCommands[strings.ToLower(msg[0])]; ok {
@@ -29,7 +48,10 @@ func (t *SlashCommandController) Update(msg tea.Msg) (Controller, tea.Cmd) {
 				return t, viewLog("Error: "+err.Error()+"\n", styleErrorText)
 			}
 
-			return t, viewLog(res+"\n", styleSlashResult)
+			return t, tea.Batch(
+				viewLog(res+"\n", styleSlashResult),
+				func() tea.Msg { return msgTranscriptRefresh{} },
+			)
 		}
 	}
 
@@ -112,3 +134,166 @@ func (t *SlashCommandController) slashSummary(args []string) (string, error) {
 
 	return buf.String() + "\n", nil
 }
+
+func (t *SlashCommandController) slashTodo(args []string) (string, error) {
+	entries, err := t.todos.List(t.cw.GetCurrentContext())
+	if err != nil {
+		return "", fmt.Errorf("/todo: %w", err)
+	}
+
+	if len(entries) == 0 {
+		return "No todo entries in this conversation.", nil
+	}
+
+	return agent.FormatTodos(entries), nil
+}
+
+func (t *SlashCommandController) slashNotes(args []string) (string, error) {
+	notes, err := t.notes.List(t.cw.GetCurrentContext())
+	if err != nil {
+		return "", fmt.Errorf("/notes: %w", err)
+	}
+
+	if len(notes) == 0 {
+		return "No notes for this conversation.", nil
+	}
+
+	return agent.FormatNotes(notes), nil
+}
+
+// compaction calls the model, so it runs as a command rather than
+// blocking the update loop.
+func (t *SlashCommandController) slashCompact(args []string) tea.Cmd {
+	if len(args) < 3 {
+		return viewLog("Error: /compact <start> <end>\n", styleErrorText)
+	}
+
+	start, err1 := strconv.Atoi(args[1])
+	end, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return viewLog("Error: /compact <start> <end>\n", styleErrorText)
+	}
+
+	return tea.Sequence(
+		viewLog("compacting...\n", styleSlashResult),
+		func() tea.Msg {
+			res, err := t.agent.Compact(context.Background(), start, end)
+			if err != nil {
+				return msgViewportLog{Msg: "Error: " + err.Error() + "\n", Style: styleErrorText}
+			}
+			return msgViewportLog{Msg: res.String() + "\n", Style: styleSlashResult}
+		},
+	)
+}
+
+func (t *SlashCommandController) slashRevive(args []string) (string, error) {
+	if len(args) < 3 {
+		return "", fmt.Errorf("/revive <start> <end>")
+	}
+
+	start, err1 := strconv.Atoi(args[1])
+	end, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return "", fmt.Errorf("/revive <start> <end>")
+	}
+
+	n, err := t.agent.SetRecordRangeLive(start, end, true)
+	if err != nil {
+		return "", fmt.Errorf("/revive: %w", err)
+	}
+
+	return fmt.Sprintf("Revived %d records; the model can see them again.", n), nil
+}
+
+const searchLimit = 50
+
+func (t *SlashCommandController) slashSearch(args []string) tea.Cmd {
+	query := strings.Join(args[1:], " ")
+	if query == "" {
+		return viewLog("Error: /search <query>\n", styleErrorText)
+	}
+
+	return func() tea.Msg {
+		hits, err := t.agent.Search(query, searchLimit)
+		if err != nil {
+			return msgViewportLog{Msg: "Error: " + err.Error() + "\n", Style: styleErrorText}
+		}
+
+		items := make([]PickerItem, len(hits))
+		for i, h := range hits {
+			items[i] = PickerItem{
+				Title:  fmt.Sprintf("%s #%d", h.Context, h.Index),
+				Detail: h.Snippet,
+				Value:  h,
+			}
+		}
+
+		return msgShowModal{
+			modal: NewPickerModal(
+				fmt.Sprintf("%d results for %q", len(hits), query),
+				items,
+				func(item PickerItem) tea.Msg {
+					h := item.Value.(agent.SearchHit)
+					return msgJumpToRecord{context: h.Context, record: h.RecordID}
+				}),
+		}
+	}
+}
+
+// the swap waits for any turn in progress, so it happens off the
+// update loop.
+func (t *SlashCommandController) slashModel(args []string) tea.Cmd {
+	if len(args) < 2 {
+		return t.pickModel()
+	}
+
+	provider, name := args[1], ""
+	if len(args) > 2 {
+		name = args[2]
+	}
+
+	// another model from the same provider is most likely at the same
+	// endpoint.
+	var baseURL string
+	if settings := t.agent.Settings(); strings.HasPrefix(settings.Model, provider+"/") {
+		baseURL = settings.BaseURL
+	}
+
+	return func() tea.Msg {
+		model, used, err := openModel(provider, name, baseURL)
+		if err != nil {
+			return msgViewportLog{Msg: "Error: /model: " + err.Error() + "\n", Style: styleErrorText}
+		}
+
+		t.agent.SetBaseURL(baseURL)
+		t.agent.SetModel(used, model)
+
+		return tea.BatchMsg{
+			func() tea.Msg { return msgModelChanged(used) },
+			viewLog("Switched to "+used+"; it sees the whole conversation.\n",
+				styleSlashResult),
+		}
+	}
+}
+
+func (t *SlashCommandController) pickModel() tea.Cmd {
+	current := t.agent.ModelName()
+
+	items := make([]PickerItem, len(knownModels))
+	for i, c := range knownModels {
+		items[i] = PickerItem{Title: c.String(), Value: c}
+		if c.String() == current {
+			items[i].Detail = "(current)"
+		}
+	}
+
+	return func() tea.Msg {
+		return msgShowModal{
+			modal: NewPickerModal("Switch model", items,
+				func(item PickerItem) tea.Msg {
+					c := item.Value.(modelChoice)
+					return msgSlashCommand{"/model", c.provider, c.name}
+				}),
+		}
+	}
+}
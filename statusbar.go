@@ -17,8 +17,10 @@ type Status struct {
 	usage          float64
 	currentTool    string
 	currentContext string
+	model          string
 	totalTools     int
 	hasFollowup    bool
+	cancelled      bool
 }
 
 func freshSpinner() spinner.Model {
@@ -55,9 +57,13 @@ func (s Status) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case msgSelectContext:
 		s.currentContext = string(msg)
 
+	case msgModelChanged:
+		s.model = string(msg)
+
 	case msgWorking:
 		if msg == true {
 			s.spinning = true
+			s.cancelled = false
 			cmds = append(cmds, s.spinner.Tick)
 		} else {
 			s.spinning = false
@@ -82,6 +88,10 @@ func (s Status) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			s.totalTools += 1
 		}
 
+	case msgCancelled:
+		s.cancelled = true
+		s.currentTool = ""
+
 	case msgShowFollowupModal:
 		s.hasFollowup = msg.hasFollowups()
 
@@ -114,6 +124,16 @@ func (s Status) View() string {
 		rb.WriteString(barStyle.Render(s.currentContext))
 	}
 
+	if s.model != "" {
+		rb.WriteString(barStyle.Bold(true).Render(" | "))
+		rb.WriteString(barStyle.Render(s.model))
+	}
+
+	if s.cancelled {
+		rb.WriteString(barStyle.Bold(true).Render(" | "))
+		rb.WriteString(barStyle.Render("cancelled"))
+	}
+
 	if s.hasFollowup {
 		rb.WriteString(barStyle.Bold(true).Render(" | "))
 		rb.WriteString(barStyle.Render("[followups: ctr-n]"))
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/truncate"
+	"github.com/superfly/contextwindow"
+
+	"smiley/agent"
+)
+
+type msgTranscriptRecords []contextwindow.Record
+type msgTranscriptRefresh struct{}
+
+var (
+	styleDeadRecord     = lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Faint(true)
+	styleSelectedRecord = lipgloss.NewStyle().Background(lipgloss.Color("237"))
+	styleCursorRecord   = lipgloss.NewStyle().Background(lipgloss.Color("62"))
+)
+
+// TranscriptView shows every record in the conversation, dead ones
+// greyed out. space drops an anchor to select a range; enter flips
+// the selection live or dead.
+type TranscriptView struct {
+	id      string
+	agent   *agent.Agent
+	w, h    int
+	records []contextwindow.Record
+	cursor  int
+	anchor  int
+	top     int
+	focused bool
+}
+
+func NewTranscriptView(id string, ag *agent.Agent) *TranscriptView {
+	return &TranscriptView{
+		id:     id,
+		agent:  ag,
+		anchor: -1,
+	}
+}
+
+func (s *TranscriptView) refresh() tea.Msg {
+	records, err := s.agent.Records()
+	if err != nil {
+		slog.Info("refresh transcript", "error", err)
+		return msgViewportLog{Msg: "transcript: " + err.Error() + "\n", Style: styleErrorText}
+	}
+
+	return msgTranscriptRecords(records)
+}
+
+func (s *TranscriptView) selection() (int, int) {
+	if s.anchor < 0 {
+		return s.cursor, s.cursor
+	}
+
+	return min(s.anchor, s.cursor), max(s.anchor, s.cursor)
+}
+
+// if everything selected is live, kill it; otherwise revive it all.
+func (s *TranscriptView) toggle() tea.Cmd {
+	start, end := s.selection()
+	if end >= len(s.records) {
+		return nil
+	}
+
+	live := false
+	for _, r := range s.records[start : end+1] {
+		if !r.Live {
+			live = true
+		}
+	}
+
+	s.anchor = -1
+
+	return func() tea.Msg {
+		if _, err := s.agent.SetRecordRangeLive(start, end, live); err != nil {
+			return msgViewportLog{Msg: "transcript: " + err.Error() + "\n", Style: styleErrorText}
+		}
+		return s.refresh()
+	}
+}
+
+func (s *TranscriptView) move(n int) {
+	s.cursor = max(0, min(s.cursor+n, len(s.records)-1))
+
+	if s.cursor < s.top {
+		s.top = s.cursor
+	}
+	if s.h > 0 && s.cursor >= s.top+s.h {
+		s.top = s.cursor - s.h + 1
+	}
+}
+
+func (s *TranscriptView) Init() tea.Cmd {
+	return s.refresh
+}
+
+func (s *TranscriptView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case msgFocusChanged:
+		s.focused = (msg.region == "top")
+
+	case msgTranscriptRefresh:
+		return s, s.refresh
+
+	case msgWorking:
+		if !bool(msg) {
+			return s, s.refresh
+		}
+
+	case msgTranscriptRecords:
+		s.records = []contextwindow.Record(msg)
+		if s.anchor >= len(s.records) {
+			s.anchor = -1
+		}
+		s.move(0)
+
+	case tea.KeyMsg:
+		if !s.focused {
+			break
+		}
+
+		switch msg.String() {
+		case "down", "j":
+			s.move(1)
+		case "up", "k":
+			s.move(-1)
+		case "pgdown":
+			s.move(s.h)
+		case "pgup":
+			s.move(-s.h)
+		case "home":
+			s.move(-len(s.records))
+		case "end":
+			s.move(len(s.records))
+		case " ":
+			if s.anchor < 0 {
+				s.anchor = s.cursor
+			} else {
+				s.anchor = -1
+			}
+		case "enter":
+			return s, s.toggle()
+		}
+
+	case WindowSize:
+		if msg.Loc == s.id {
+			s.w = msg.Width
+			s.h = msg.Height
+			s.move(0)
+		}
+	}
+
+	return s, nil
+}
+
+func recordKind(source contextwindow.RecordType) string {
+	switch source {
+	case contextwindow.Prompt:
+		return "user"
+	case contextwindow.ModelResp:
+		return "model"
+	case contextwindow.ToolCall:
+		return "toolcall"
+	case contextwindow.ToolOutput:
+		return "tool"
+	}
+	return "system"
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func (s *TranscriptView) View() string {
+	if s.w == 0 || s.h == 0 {
+		return ""
+	}
+
+	if len(s.records) == 0 {
+		return styleDeadRecord.Render("(no records)")
+	}
+
+	start, end := s.selection()
+	lines := []string{}
+
+	for i := s.top; i < len(s.records) && i < s.top+s.h; i++ {
+		r := s.records[i]
+
+		state := "live"
+		if !r.Live {
+			state = "dead"
+		}
+
+		line := fmt.Sprintf("%4d %-4s %-8s %s", i, state, recordKind(r.Source), oneLine(r.Content))
+		line = truncate.StringWithTail(line, uint(s.w), "…")
+
+		style := lipgloss.NewStyle().Width(s.w)
+		if !r.Live {
+			style = styleDeadRecord.Width(s.w)
+		}
+
+		switch {
+		case i == s.cursor && s.focused:
+			style = style.Inherit(styleCursorRecord)
+		case s.anchor >= 0 && i >= start && i <= end:
+			style = style.Inherit(styleSelectedRecord)
+		}
+
+		lines = append(lines, style.Render(line))
+	}
+
+	return strings.Join(lines, "\n")
+}
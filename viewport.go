@@ -12,19 +12,29 @@ import (
 )
 
 type Viewport struct {
-	lock    sync.Mutex
-	Content []string
-	live    *strings.Builder
-	ID      string
-	vm      viewport.Model
-	focused bool
+	lock        sync.Mutex
+	Content     []string
+	live        *strings.Builder
+	stream      *strings.Builder
+	streamStyle lipgloss.Style
+	ID          string
+	vm          viewport.Model
+	focused     bool
+	anchors     map[int64]int
 }
 
+// RecordID, when set, lets msgScrollToRecord find this entry later.
 type msgViewportLog struct {
-	Msg   string
-	Style lipgloss.Style
+	Msg      string
+	Style    lipgloss.Style
+	RecordID int64
 }
 
+type msgScrollToRecord int64
+
+type msgViewportDelta msgViewportLog
+type msgViewportStreamEnd struct{}
+
 type msgResetViewport []msgViewportLog
 
 func NewViewport(id, content string) *Viewport {
@@ -33,6 +43,7 @@ func NewViewport(id, content string) *Viewport {
 		vm:      viewport.New(0, 0),
 		Content: []string{content},
 		live:    &strings.Builder{},
+		stream:  &strings.Builder{},
 	}
 	v.vm.SetContent(content)
 	v.vm.GotoTop()
@@ -68,10 +79,22 @@ func (v *Viewport) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case msgResetViewport:
 		v.resetViewport(msg)
 
+	case msgScrollToRecord:
+		if line, ok := v.anchors[int64(msg)]; ok {
+			v.vm.SetYOffset(line)
+		}
+
 	case msgViewportLog:
 		v.Add(msg.Style.Render(msg.Msg))
 		v.vm.GotoBottom()
 
+	case msgViewportDelta:
+		v.appendStream(msg.Msg, msg.Style)
+		v.vm.GotoBottom()
+
+	case msgViewportStreamEnd:
+		v.endStream()
+
 	case WindowSize:
 		if msg.Loc == v.ID {
 			v.vm.Height = msg.Height
@@ -115,9 +138,14 @@ func (v *Viewport) resetViewport(lines []msgViewportLog) {
 
 	v.Content = []string{}
 	v.live.Reset()
+	v.stream.Reset()
+	v.anchors = map[int64]int{}
 
 	// don't want to call SetContent in a loop
 	for _, line := range lines {
+		if line.RecordID != 0 {
+			v.anchors[line.RecordID] = strings.Count(v.live.String(), "\n")
+		}
 		entry := line.Style.Render(wordwrap.String(line.Msg, v.vm.Width-5))
 		v.Content = append(v.Content, entry)
 		v.live.WriteString(entry + "\n")
@@ -132,5 +160,33 @@ func (v *Viewport) Add(c string) {
 	entry := wordwrap.String(c, v.vm.Width-5)
 	v.Content = append(v.Content, entry)
 	v.live.WriteString(entry + "\n")
-	v.vm.SetContent(v.live.String())
+	v.refresh()
+}
+
+func (v *Viewport) appendStream(delta string, style lipgloss.Style) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.stream.WriteString(delta)
+	v.streamStyle = style
+	v.refresh()
+}
+
+func (v *Viewport) endStream() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.stream.Len() == 0 {
+		return
+	}
+	v.stream.Reset()
+	v.refresh()
+}
+
+func (v *Viewport) refresh() {
+	if v.stream.Len() == 0 {
+		v.vm.SetContent(v.live.String())
+		return
+	}
+
+	entry := wordwrap.String(v.stream.String(), v.vm.Width-5)
+	v.vm.SetContent(v.live.String() + v.streamStyle.Render(entry) + "\n")
 }